@@ -3,7 +3,6 @@ package msgraph
 import (
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/json"
 	"io"
 	"net/url"
 	"os"
@@ -65,34 +64,18 @@ func (a Attachment) WriteFile(filename string, perm os.FileMode) error {
 }
 
 func (c *Client) ListAttachments(upn string, msgId string, options ...ApiOption) ([]Attachment, error) {
-	var (
-		err error
-	)
+	p, err := c.ListAttachmentsPager(upn, msgId, options...)
+	if err != nil {
+		return nil, err
+	}
+	return p.Collect()
+}
 
-	apiUrl, err := formatOptions("https://graph.microsoft.com/v1.0/users/"+url.PathEscape(upn)+"/messages/"+url.PathEscape(msgId)+"/attachments",
-		options)
+func (c *Client) ListAttachmentsPager(upn string, msgId string, options ...ApiOption) (*Pager[Attachment], error) {
+	apiUrl, err := formatOptions(c.graphUrl("/users/"+url.PathEscape(upn)+"/messages/"+url.PathEscape(msgId)+"/attachments"),
+		options...)
 	if err != nil {
 		return nil, err
 	}
-	max, count := getMaxItemOption(options), 0
-	list := make([]Attachment, 0, 128)
-	c.executeGetList(apiUrl, nil, func(body io.Reader) string {
-		var (
-			reply struct {
-				Context  string       `json:"@odata.context"`
-				Nextlink string       `json:"@odata.nextLink"`
-				Data     []Attachment `json:"value"`
-			}
-		)
-		if err = json.NewDecoder(body).Decode(&reply); err == nil {
-			list = append(list, reply.Data...)
-			count += len(reply.Data)
-			if count >= max {
-				return ""
-			}
-			return reply.Nextlink
-		}
-		return ""
-	})
-	return list, err
+	return newPager[Attachment](c, apiUrl, options), nil
 }
@@ -5,10 +5,15 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"html/template"
+	"net"
 	"net/http"
 	"os/exec"
 	"runtime"
+	"strings"
 	"time"
+
+	"golang.org/x/oauth2"
 )
 
 type callbackReturn struct {
@@ -17,58 +22,193 @@ type callbackReturn struct {
 	errdesc string // longer description some providers return
 }
 
-const closeWindowJS = `<!doctype html><html><body><script>close();</script></body></html>`
+// loginOptions configure the browser sign in of NewClient
+type loginOptions struct {
+	addr        string
+	path        string
+	successPage *template.Template
+	failurePage *template.Template
+	browser     func(authUrl string) error
+	params      []oauth2.AuthCodeOption
+}
+
+// LoginPage is the data given to the success and failure page templates
+type LoginPage struct {
+	Error       string // the error code, empty on success
+	Description string
+}
+
+var (
+	defaultSuccessPage = template.Must(template.New("success").Parse(`<!doctype html>
+<html><head><title>Signed in</title></head>
+<body><p>You are signed in and may close this window.</p><script>close();</script></body></html>`))
+	defaultFailurePage = template.Must(template.New("failure").Parse(`<!doctype html>
+<html><head><title>Sign in failed</title></head>
+<body><p>Sign in failed: {{.Error}}</p><p>{{.Description}}</p></body></html>`))
+)
+
+// Listen for the sign in callback of NewClient on addr rather than localhost:8001.  A port of 0 picks a free
+// port, which is then used in the redirect URI; Azure AD ignores the port of http://localhost redirect URIs.
+// The redirect URI names localhost when addr has no host or one listening on all interfaces, e.g. 0.0.0.0.
+func WithLoginAddress(addr string) ClientOption {
+	return func(c *Client) {
+		c.login.addr = addr
+	}
+}
+
+// Use path for the sign in callback of NewClient rather than /authcb.  A missing leading / is added.
+func WithRedirectPath(path string) ClientOption {
+	return func(c *Client) {
+		c.login.path = path
+	}
+}
+
+// Show these pages in the browser when the sign in of NewClient completes.  The templates are executed with
+// a LoginPage; either may be nil to keep the default.
+func WithLoginPages(success *template.Template, failure *template.Template) ClientOption {
+	return func(c *Client) {
+		if success != nil {
+			c.login.successPage = success
+		}
+		if failure != nil {
+			c.login.failurePage = failure
+		}
+	}
+}
+
+// Call browser with the sign in URL instead of opening the system's web browser, e.g. to print the URL
+func WithBrowser(browser func(authUrl string) error) ClientOption {
+	return func(c *Client) {
+		c.login.browser = browser
+	}
+}
+
+// Controls the sign in prompt: "login" forces credentials to be entered, "select_account" shows the account
+// picker, "consent" asks for consent again and "none" fails rather than interact
+func WithPrompt(prompt string) ClientOption {
+	return withAuthParam("prompt", prompt)
+}
 
-func (c *Client) startCallbackServer(ctx context.Context, state string, userWait time.Duration) chan callbackReturn {
-	returnChan := make(chan callbackReturn)
-	codeChan := make(chan callbackReturn)
+// Prefills the sign in page with the user's name, e.g. their UPN
+func WithLoginHint(upn string) ClientOption {
+	return withAuthParam("login_hint", upn)
+}
+
+// Sends the user straight to the sign in page of their organisation's federated identity provider
+func WithDomainHint(domain string) ClientOption {
+	return withAuthParam("domain_hint", domain)
+}
+
+func withAuthParam(key string, value string) ClientOption {
+	return func(c *Client) {
+		c.login.params = append(c.login.params, oauth2.SetAuthURLParam(key, value))
+	}
+}
+
+// interactiveLogin opens the sign in page in a browser and waits for the callback with the code.  The callback
+// server is shut down on every return path.
+func (c *Client) interactiveLogin(ctx context.Context, userWait time.Duration) (code string, err error) {
+	opts := c.login
+	if len(opts.addr) == 0 {
+		opts.addr = "localhost:8001"
+	}
+	if len(opts.path) == 0 {
+		opts.path = "/authcb"
+	} else if !strings.HasPrefix(opts.path, "/") {
+		opts.path = "/" + opts.path // else it would be a ServeMux host pattern and join the port in the redirect URI
+	}
+	if opts.successPage == nil {
+		opts.successPage = defaultSuccessPage
+	}
+	if opts.failurePage == nil {
+		opts.failurePage = defaultFailurePage
+	}
+	if opts.browser == nil {
+		opts.browser = openUrl
+	}
+	ln, err := net.Listen("tcp", opts.addr)
+	if err != nil {
+		return "", err
+	}
+	host, _, _ := net.SplitHostPort(opts.addr)
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	if ip := net.ParseIP(host); len(host) == 0 || ip != nil && ip.IsUnspecified() {
+		host = "localhost" // listening on all interfaces, which a browser can't connect to
+	}
+	c.OauthConfig.RedirectURL = "http://" + net.JoinHostPort(host, port) + opts.path
+
+	state, err := generateNonce(16)
+	if err != nil {
+		ln.Close()
+		return "", err
+	}
+	codeChan := make(chan callbackReturn, 1)
 	mux := http.NewServeMux()
-	mux.HandleFunc("/authcb", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc(opts.path, func(w http.ResponseWriter, r *http.Request) {
 		var x callbackReturn
-		defer r.Body.Close()
+		page := LoginPage{}
 		if v := r.FormValue("error"); len(v) > 0 {
 			x.err = fmt.Errorf("%s", v)
 			x.errdesc = r.FormValue("error_description")
-			if len(x.errdesc) > 0 {
-				w.Write([]byte(x.errdesc))
-			} else {
-				w.Write([]byte(v))
-			}
+			page = LoginPage{Error: v, Description: x.errdesc}
+		} else if r.FormValue("state") != state {
+			x.err = fmt.Errorf("invalid state during callback")
+			page = LoginPage{Error: "invalid_state", Description: "The sign in response doesn't match the request."}
 		} else {
-			if r.FormValue("state") != state {
-				x.err = fmt.Errorf("invalid state during callback")
-				http.Error(w, "state doesn't match", http.StatusBadRequest)
-			} else {
-				x.code = r.FormValue("code")
-				w.Write([]byte(closeWindowJS))
-			}
+			x.code = r.FormValue("code")
 		}
-		codeChan <- x
-	})
-	srv := &http.Server{Addr: "localhost:8001", Handler: mux}
-	go func() {
-		serveErr := srv.ListenAndServe()
-		if serveErr == http.ErrServerClosed {
-			serveErr = nil
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if len(page.Error) > 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			opts.failurePage.Execute(w, page)
 		} else {
-			codeChan <- callbackReturn{err: serveErr}
+			opts.successPage.Execute(w, page)
 		}
-	}()
-	go func() {
-		var ret callbackReturn
+		// only the first callback counts, later ones such as a page reload are ignored
 		select {
-		case ret = <-codeChan:
-			c, _ := context.WithTimeout(ctx, 3*time.Second)
-			srv.Shutdown(c)
-			srv.Close()
-		case <-ctx.Done():
-			ret.err = fmt.Errorf("context closed")
-		case <-time.After(userWait):
-			ret.err = fmt.Errorf("timeout, no callback received")
+		case codeChan <- x:
+		default:
+		}
+	})
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if serveErr := srv.Serve(ln); serveErr != http.ErrServerClosed {
+			select {
+			case codeChan <- callbackReturn{err: serveErr}:
+			default:
+			}
 		}
-		returnChan <- ret
 	}()
-	return returnChan
+	defer func() {
+		// let the page be delivered, then close whatever is left
+		sctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		srv.Shutdown(sctx)
+		cancel()
+		srv.Close()
+		ln.Close() // in case Serve hasn't started yet
+	}()
+
+	params := append([]oauth2.AuthCodeOption{oauth2.AccessTypeOffline}, opts.params...)
+	if err = opts.browser(c.OauthConfig.AuthCodeURL(state, params...)); err != nil {
+		return "", err
+	}
+	var timeout <-chan time.Time
+	if userWait > 0 {
+		timer := time.NewTimer(userWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case ret := <-codeChan:
+		if ret.err != nil && len(ret.errdesc) > 0 {
+			return "", fmt.Errorf("%w: %s", ret.err, ret.errdesc)
+		}
+		return ret.code, ret.err
+	case <-ctx.Done():
+		return "", fmt.Errorf("context closed: %w", ctx.Err())
+	case <-timeout:
+		return "", fmt.Errorf("timeout, no callback received")
+	}
 }
 
 func generateNonce(len int) (string, error) {
@@ -0,0 +1,151 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewClientLogin(t *testing.T) {
+	var redirect string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "thecode" || r.FormValue("redirect_uri") != redirect {
+			t.Errorf("unexpected token request %v", r.Form)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "abc", "refresh_token": "def",
+			"token_type": "Bearer", "expires_in": 3600})
+	}))
+	defer srv.Close()
+
+	var page string
+	success := template.Must(template.New("ok").Parse("all done"))
+	browser := func(authUrl string) error {
+		u, _ := url.Parse(authUrl)
+		q := u.Query()
+		redirect = q.Get("redirect_uri")
+		if q.Get("login_hint") != "bob@acme.com" || q.Get("domain_hint") != "acme.com" || q.Get("prompt") != "select_account" {
+			t.Errorf("unexpected auth URL %s", authUrl)
+		}
+		if !strings.HasPrefix(redirect, "http://127.0.0.1:") || strings.HasPrefix(redirect, "http://127.0.0.1:0/") ||
+			!strings.HasSuffix(redirect, "/signin") {
+			t.Errorf("unexpected redirect URI %s", redirect)
+		}
+		res, err := http.Get(redirect + "?code=thecode&state=" + url.QueryEscape(q.Get("state")))
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		page = string(body)
+		return nil
+	}
+	cache := &memoryCache{}
+	c, err := NewClient(context.Background(), "tenant", "client", "secret", []string{"Mail.Read"}, cache, time.Minute,
+		WithAuthorityHost(srv.URL), WithLoginAddress("127.0.0.1:0"), WithRedirectPath("signin"),
+		WithLoginPages(success, nil), WithBrowser(browser), WithLoginHint("bob@acme.com"),
+		WithDomainHint("acme.com"), WithPrompt("select_account"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page != "all done" {
+		t.Errorf("unexpected page %q", page)
+	}
+	if c.token.AccessToken != "abc" || cache.token == nil {
+		t.Errorf("token not exchanged and saved: %v", c.token)
+	}
+}
+
+func TestNewClientLoginFailure(t *testing.T) {
+	var (
+		page     string
+		redirect string
+	)
+	browser := func(authUrl string) error {
+		u, _ := url.Parse(authUrl)
+		redirect = u.Query().Get("redirect_uri")
+		res, err := http.Get(redirect + "?error=access_denied&error_description=" + url.QueryEscape("<b>no</b>"))
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		body, _ := ioutil.ReadAll(res.Body)
+		page = string(body)
+		return nil
+	}
+	_, err := NewClient(context.Background(), "tenant", "client", "secret", nil, nil, time.Minute,
+		WithLoginAddress("127.0.0.1:0"), WithBrowser(browser))
+	if err == nil || !strings.Contains(err.Error(), "access_denied") {
+		t.Errorf("expected access_denied, got %v", err)
+	}
+	if !strings.Contains(page, "&lt;b&gt;no&lt;/b&gt;") {
+		t.Errorf("error description not escaped: %s", page)
+	}
+	// the callback server must be gone
+	if _, err = http.Get(redirect); err == nil {
+		t.Error("callback server still running")
+	}
+}
+
+func TestNewClientLoginShutdown(t *testing.T) {
+	var addr string
+	browser := func(authUrl string) error {
+		u, _ := url.Parse(authUrl)
+		r, _ := url.Parse(u.Query().Get("redirect_uri"))
+		addr = r.Host
+		return nil
+	}
+	_, err := NewClient(context.Background(), "tenant", "client", "secret", nil, nil, 50*time.Millisecond,
+		WithLoginAddress("127.0.0.1:0"), WithBrowser(browser))
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("expected timeout, got %v", err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("listener not closed after timeout: %v", err)
+	}
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = NewClient(ctx, "tenant", "client", "secret", nil, nil, time.Minute,
+		WithLoginAddress(addr), WithBrowser(func(string) error {
+			cancel()
+			return nil
+		}))
+	if err == nil || !strings.Contains(err.Error(), "context") {
+		t.Errorf("expected context error, got %v", err)
+	}
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("listener not closed after cancel: %v", err)
+	}
+	ln.Close()
+}
+
+func TestNewClientLoginRedirectHost(t *testing.T) {
+	for addr, want := range map[string]string{":0": "localhost", "0.0.0.0:0": "localhost", "127.0.0.1:0": "127.0.0.1"} {
+		var redirect string
+		browser := func(authUrl string) error {
+			u, _ := url.Parse(authUrl)
+			redirect = u.Query().Get("redirect_uri")
+			return errors.New("no browser")
+		}
+		_, err := NewClient(context.Background(), "tenant", "client", "secret", nil, nil, time.Minute,
+			WithLoginAddress(addr), WithBrowser(browser))
+		if err == nil {
+			t.Fatal("NewClient() succeeded without signing in")
+		}
+		if u, _ := url.Parse(redirect); u == nil || u.Hostname() != want || u.Port() == "0" {
+			t.Errorf("listening on %s gave redirect URI %s, want host %s", addr, redirect, want)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package msgraph
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Graph accepts at most this many sub-requests in one JSON batch
+const MaxBatchRequests = 20
+
+// BatchRequest is one sub-request of a JSON batch [see https://docs.microsoft.com/en-us/graph/json-batching].
+// URL is relative to the API version, e.g. "/users/bob@acme.com/photo".  On success the sub-response body
+// is decoded into Target (if not nil).  After the batch has run, Status holds the HTTP status of the
+// sub-response and Err any error specific to this item, normally an *MsGraphError.
+type BatchRequest struct {
+	ID        string
+	Method    string
+	URL       string
+	Headers   map[string]string
+	Body      interface{}
+	DependsOn []string
+	Target    interface{}
+	Status    int
+	Err       error
+}
+
+type Batch struct {
+	client   *Client
+	requests []*BatchRequest
+}
+
+type batchRequestJson struct {
+	ID        string            `json:"id"`
+	Method    string            `json:"method"`
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      interface{}       `json:"body,omitempty"`
+	DependsOn []string          `json:"dependsOn,omitempty"`
+}
+
+type batchResponseJson struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// BatchError collects the failures of individual sub-requests keyed by request ID
+// (or by UserPrincipalName for the batched convenience methods)
+type BatchError map[string]error
+
+func (e BatchError) Error() string {
+	keys := make([]string, 0, len(e))
+	for k := range e {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) == 1 {
+		return fmt.Sprintf("batch request %s failed: %v", keys[0], e[keys[0]])
+	}
+	return fmt.Sprintf("%d batch requests failed, first %s: %v", len(keys), keys[0], e[keys[0]])
+}
+
+func (c *Client) NewBatch() *Batch {
+	return &Batch{client: c}
+}
+
+// Adds a sub-request to the batch.  If the request has no ID, its position in the batch is used.
+func (b *Batch) Add(req *BatchRequest) error {
+	if len(b.requests) >= MaxBatchRequests {
+		return fmt.Errorf("cannot have more than %d requests in a batch", MaxBatchRequests)
+	}
+	if len(req.ID) == 0 {
+		req.ID = strconv.Itoa(len(b.requests) + 1)
+	}
+	if len(req.Method) == 0 {
+		req.Method = "GET"
+	}
+	for _, r := range b.requests {
+		if r.ID == req.ID {
+			return fmt.Errorf("duplicate batch request id %s", req.ID)
+		}
+	}
+	for _, d := range req.DependsOn {
+		if b.find(d) == nil {
+			return fmt.Errorf("batch request %s depends on unknown request %s", req.ID, d)
+		}
+	}
+	b.requests = append(b.requests, req)
+	return nil
+}
+
+// Adds a GET sub-request whose response is decoded into target
+func (b *Batch) Get(id string, path string, target interface{}) error {
+	return b.Add(&BatchRequest{ID: id, Method: "GET", URL: path, Target: target})
+}
+
+func (b *Batch) Requests() []*BatchRequest {
+	return b.requests
+}
+
+func (b *Batch) find(id string) *BatchRequest {
+	for _, r := range b.requests {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// Sends the batch.  Sub-requests which Graph throttled are sent again, in a new batch, after waiting
+// the longest Retry-After of the throttled items; the client's RetryPolicy bounds the number of attempts
+// and the total wait.  The returned error reports failure of the batch as a whole; per item results
+// are in each BatchRequest.  Use Err to get the item failures combined as a BatchError.
+func (b *Batch) Execute() error {
+	pending := b.requests
+	var waited time.Duration
+	for attempt := 1; len(pending) > 0; attempt++ {
+		if err := b.send(pending); err != nil {
+			return err
+		}
+		var (
+			retry []*BatchRequest
+			wait  time.Duration
+		)
+		for _, r := range pending {
+			if r.Status == http.StatusTooManyRequests {
+				retry = append(retry, r)
+			}
+		}
+		if len(retry) == 0 || attempt >= b.client.retry.MaxAttempts {
+			break
+		}
+		// anything which failed only because a throttled request it depends on didn't run goes again too
+		for _, r := range pending {
+			if r.Status == http.StatusFailedDependency && dependsOnAny(r, retry) {
+				retry = append(retry, r)
+			}
+		}
+		for _, r := range retry {
+			if e, ok := r.Err.(*MsGraphError); ok && e.RetryAfter > wait {
+				wait = e.RetryAfter
+			}
+		}
+		if wait == 0 {
+			wait = b.client.retry.backoff(attempt)
+		}
+		if b.client.retry.MaxWait > 0 && waited+wait > b.client.retry.MaxWait {
+			break
+		}
+		if b.client.hooks.Retry != nil {
+			for _, r := range retry {
+				b.client.hooks.Retry(b.client.parentCtx, strings.ToUpper(r.Method), attempt, r.response(), nil, wait)
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-b.client.parentCtx.Done():
+			timer.Stop()
+			return b.client.parentCtx.Err()
+		case <-timer.C:
+		}
+		waited += wait
+		pending = retry
+	}
+	return nil
+}
+
+// Returns the failed sub-requests as a BatchError, or nil if every item succeeded
+func (b *Batch) Err() error {
+	errs := make(BatchError)
+	for _, r := range b.requests {
+		if r.Err != nil {
+			errs[r.ID] = r.Err
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// response stands in for the HTTP response of a sub-request when reporting it to Hooks.Retry
+func (r *BatchRequest) response() *http.Response {
+	return &http.Response{
+		StatusCode: r.Status,
+		Status:     strconv.Itoa(r.Status) + " " + http.StatusText(r.Status),
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+	}
+}
+
+func dependsOnAny(r *BatchRequest, list []*BatchRequest) bool {
+	for _, d := range r.DependsOn {
+		for _, x := range list {
+			if x.ID == d {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (b *Batch) send(list []*BatchRequest) error {
+	var (
+		payload struct {
+			Requests []batchRequestJson `json:"requests"`
+		}
+		reply struct {
+			Responses []batchResponseJson `json:"responses"`
+		}
+	)
+	inBatch := make(map[string]bool, len(list))
+	for _, r := range list {
+		inBatch[r.ID] = true
+	}
+	for _, r := range list {
+		x := batchRequestJson{
+			ID:      r.ID,
+			Method:  strings.ToUpper(r.Method),
+			URL:     r.URL,
+			Headers: r.Headers,
+			Body:    r.Body,
+		}
+		if r.Body != nil {
+			if x.Headers == nil {
+				x.Headers = make(map[string]string)
+			}
+			if _, ok := x.Headers["Content-Type"]; !ok {
+				x.Headers["Content-Type"] = "application/json"
+			}
+		}
+		// a dependency which already completed in an earlier round can't be referenced again
+		for _, d := range r.DependsOn {
+			if inBatch[d] {
+				x.DependsOn = append(x.DependsOn, d)
+			}
+		}
+		payload.Requests = append(payload.Requests, x)
+	}
+	err := b.client.executePost(b.client.graphUrl("/$batch"), payload, func(reader io.Reader) error {
+		return json.NewDecoder(reader).Decode(&reply)
+	})
+	if err != nil {
+		return err
+	}
+	for _, res := range reply.Responses {
+		if r := b.find(res.ID); r != nil {
+			r.Status = res.Status
+			r.Err = res.result(r.Target)
+		}
+	}
+	return nil
+}
+
+// result decodes a successful sub-response into target or converts a failure into an *MsGraphError
+func (res batchResponseJson) result(target interface{}) error {
+	if res.Status >= 200 && res.Status <= 299 {
+		if target == nil || len(res.Body) == 0 {
+			return nil
+		}
+		if b, ok := target.(*[]byte); ok {
+			// non-JSON content, such as a photo, is returned base64 encoded
+			var s string
+			if err := json.Unmarshal(res.Body, &s); err != nil {
+				return err
+			}
+			data, err := base64.StdEncoding.DecodeString(s)
+			if err == nil {
+				*b = data
+			}
+			return err
+		}
+		return json.Unmarshal(res.Body, target)
+	}
+	return parseMsGraphError(res.Status, "", headerLookup(res.Headers), res.Body)
+}
+
+// runBatches executes independent requests, MaxBatchRequests at a time
+func (c *Client) runBatches(list []*BatchRequest) error {
+	for len(list) > 0 {
+		n := len(list)
+		if n > MaxBatchRequests {
+			n = MaxBatchRequests
+		}
+		b := c.NewBatch()
+		for _, r := range list[:n] {
+			if err := b.Add(r); err != nil {
+				return err
+			}
+		}
+		if err := b.Execute(); err != nil {
+			return err
+		}
+		list = list[n:]
+	}
+	return nil
+}
+
+// Get profile picture info for many users using JSON batching.  Returns the info of every user which
+// has a photo; failures, including users without a photo (HTTP 404), are reported through a BatchError
+// keyed by UserPrincipalName.
+func (c *Client) GetUserPhotoInfoBatch(upns []string) (map[string]PhotoInfo, error) {
+	infos := make([]PhotoInfo, len(upns))
+	list := make([]*BatchRequest, len(upns))
+	for i, upn := range upns {
+		list[i] = &BatchRequest{
+			ID:     strconv.Itoa(i + 1),
+			Method: "GET",
+			URL:    "/users/" + url.PathEscape(upn) + "/photo",
+			Target: &infos[i],
+		}
+	}
+	if err := c.runBatches(list); err != nil {
+		return nil, err
+	}
+	result := make(map[string]PhotoInfo, len(upns))
+	errs := make(BatchError)
+	for i, r := range list {
+		if r.Err != nil {
+			errs[upns[i]] = r.Err
+		} else {
+			result[upns[i]] = infos[i]
+		}
+	}
+	if len(errs) > 0 {
+		return result, errs
+	}
+	return result, nil
+}
+
+// List the Inbox message rules for many users using JSON batching.  Any further pages are fetched
+// individually.  Failures are reported through a BatchError keyed by UserPrincipalName.
+func (c *Client) ListMessageRulesBatch(upns []string) (map[string][]MessageRule, error) {
+	type rulesReply struct {
+		Nextlink string        `json:"@odata.nextLink"`
+		Data     []MessageRule `json:"value"`
+	}
+	replies := make([]rulesReply, len(upns))
+	list := make([]*BatchRequest, len(upns))
+	for i, upn := range upns {
+		list[i] = &BatchRequest{
+			ID:     strconv.Itoa(i + 1),
+			Method: "GET",
+			URL:    "/users/" + url.PathEscape(upn) + "/mailFolders/inbox/messagerules",
+			Target: &replies[i],
+		}
+	}
+	if err := c.runBatches(list); err != nil {
+		return nil, err
+	}
+	result := make(map[string][]MessageRule, len(upns))
+	errs := make(BatchError)
+	for i, r := range list {
+		if r.Err != nil {
+			errs[upns[i]] = r.Err
+			continue
+		}
+		// any further pages are fetched individually
+		var more []MessageRule
+		p, err := ResumePager[MessageRule](c, replies[i].Nextlink)
+		if err == nil {
+			more, err = p.Collect()
+		}
+		rules := append(replies[i].Data, more...)
+		if err != nil {
+			errs[upns[i]] = err
+		} else {
+			result[upns[i]] = rules
+		}
+	}
+	if len(errs) > 0 {
+		return result, errs
+	}
+	return result, nil
+}
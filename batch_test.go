@@ -0,0 +1,208 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client whose token and Graph requests go to a test server, with quick retries.
+// Token requests are answered by the server, anything else is passed to handler.
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*Client, *httptest.Server) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tenant/oauth2/v2.0/token" {
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"access_token":"abc","token_type":"Bearer","expires_in":3600}`)
+			return
+		}
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	c, err := NewKeyClient(context.Background(), "tenant", "client", "secret",
+		WithAuthorityHost(srv.URL), WithGraphEndpoint(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	return c, srv
+}
+
+type testBatchPayload struct {
+	Requests []batchRequestJson `json:"requests"`
+}
+
+func writeBatchReply(w http.ResponseWriter, responses ...batchResponseJson) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"responses": responses})
+}
+
+func TestBatch_Add(t *testing.T) {
+	b := (&Client{}).NewBatch()
+	if err := b.Add(&BatchRequest{URL: "/me"}); err != nil {
+		t.Fatal(err)
+	}
+	if r := b.Requests()[0]; r.ID != "1" || r.Method != "GET" {
+		t.Errorf("defaults not applied: %+v", r)
+	}
+	if err := b.Add(&BatchRequest{ID: "1", URL: "/me"}); err == nil {
+		t.Error("duplicate ID accepted")
+	}
+	if err := b.Add(&BatchRequest{ID: "2", URL: "/me", DependsOn: []string{"9"}}); err == nil {
+		t.Error("unknown dependency accepted")
+	}
+	for i := len(b.Requests()); i < MaxBatchRequests; i++ {
+		if err := b.Add(&BatchRequest{URL: "/me"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Add(&BatchRequest{URL: "/me"}); err == nil {
+		t.Errorf("more than %d requests accepted", MaxBatchRequests)
+	}
+}
+
+func TestBatch_Execute(t *testing.T) {
+	var rounds []testBatchPayload
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.0/$batch" || r.Method != "POST" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var payload testBatchPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		rounds = append(rounds, payload)
+		if len(rounds) == 1 {
+			writeBatchReply(w,
+				batchResponseJson{ID: "photo", Status: 200, Body: json.RawMessage(`"aGVsbG8="`)},
+				batchResponseJson{ID: "missing", Status: 404,
+					Body: json.RawMessage(`{"error":{"code":"ErrorItemNotFound","message":"not found"}}`)},
+				batchResponseJson{ID: "create", Status: 429, Headers: map[string]string{"Retry-After": "1"},
+					Body: json.RawMessage(`{"error":{"code":"TooManyRequests","message":"slow down"}}`)},
+				batchResponseJson{ID: "update", Status: 424,
+					Body: json.RawMessage(`{"error":{"code":"FailedDependency","message":"create failed"}}`)})
+			return
+		}
+		writeBatchReply(w,
+			batchResponseJson{ID: "create", Status: 201, Body: json.RawMessage(`{"id":"e1"}`)},
+			batchResponseJson{ID: "update", Status: 204})
+	})
+
+	var (
+		photo []byte
+		event struct{ ID string }
+	)
+	b := c.NewBatch()
+	for _, r := range []*BatchRequest{
+		{ID: "photo", URL: "/me/photo/$value", Target: &photo},
+		{ID: "missing", URL: "/me/messages/x"},
+		{ID: "create", Method: "post", URL: "/me/events", Body: map[string]string{"subject": "hi"}, Target: &event},
+		{ID: "update", Method: "PATCH", URL: "/me/events/e1", Body: map[string]string{"subject": "hello"}, DependsOn: []string{"create"}},
+	} {
+		if err := b.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now()
+	if err := b.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want the Retry-After of 1s", elapsed)
+	}
+
+	if len(rounds) != 2 || len(rounds[0].Requests) != 4 || len(rounds[1].Requests) != 2 {
+		t.Fatalf("unexpected rounds %+v", rounds)
+	}
+	first := rounds[0].Requests
+	if first[2].Method != "POST" || first[2].Headers["Content-Type"] != "application/json" ||
+		len(first[3].DependsOn) != 1 || first[3].DependsOn[0] != "create" {
+		t.Errorf("unexpected first round %+v", first)
+	}
+	second := rounds[1].Requests
+	if second[0].ID != "create" || second[1].ID != "update" || len(second[1].DependsOn) != 1 {
+		t.Errorf("throttled request and its dependant not resent together: %+v", second)
+	}
+
+	if string(photo) != "hello" || event.ID != "e1" {
+		t.Errorf("targets not decoded: %q %+v", photo, event)
+	}
+	var gerr *MsGraphError
+	missing := b.Requests()[1]
+	if missing.Status != 404 || !errors.As(missing.Err, &gerr) || gerr.Code != "ErrorItemNotFound" {
+		t.Errorf("per item error = %d %v", missing.Status, missing.Err)
+	}
+	if b.Requests()[3].Status != 204 || b.Requests()[3].Err != nil {
+		t.Errorf("dependant request = %d %v", b.Requests()[3].Status, b.Requests()[3].Err)
+	}
+	berr, ok := b.Err().(BatchError)
+	if !ok || len(berr) != 1 || berr["missing"] == nil {
+		t.Errorf("Err() = %v, want only the missing item", b.Err())
+	}
+}
+
+func TestBatch_throttledGivesUp(t *testing.T) {
+	var calls int
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeBatchReply(w, batchResponseJson{ID: "1", Status: 429,
+			Body: json.RawMessage(`{"error":{"code":"TooManyRequests","message":"slow down"}}`)})
+	})
+	var retries []int
+	c.SetHooks(Hooks{Retry: func(ctx context.Context, method string, attempt int, res *http.Response, err error, wait time.Duration) {
+		if method != "GET" || res.StatusCode != 429 {
+			t.Errorf("Retry hook called with %s %d", method, res.StatusCode)
+		}
+		retries = append(retries, attempt)
+	}})
+	b := c.NewBatch()
+	b.Get("1", "/me", nil)
+	if err := b.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || b.Requests()[0].Status != 429 || b.Err() == nil {
+		t.Errorf("sent %d times with status %d, want 3 attempts ending in 429", calls, b.Requests()[0].Status)
+	}
+	if len(retries) != 2 || retries[1] != 2 {
+		t.Errorf("Retry hook called for attempts %v, want [1 2]", retries)
+	}
+}
+
+func TestGetUserPhotoInfoBatch(t *testing.T) {
+	var sizes []int
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var payload testBatchPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		sizes = append(sizes, len(payload.Requests))
+		var responses []batchResponseJson
+		for _, req := range payload.Requests {
+			if strings.Contains(req.URL, "nophoto") {
+				responses = append(responses, batchResponseJson{ID: req.ID, Status: 404,
+					Body: json.RawMessage(`{"error":{"code":"ImageNotFound","message":"no photo"}}`)})
+			} else {
+				responses = append(responses, batchResponseJson{ID: req.ID, Status: 200,
+					Body: json.RawMessage(`{"height":48,"width":48}`)})
+			}
+		}
+		writeBatchReply(w, responses...)
+	})
+	var upns []string
+	for i := 0; i < 45; i++ {
+		upns = append(upns, "user"+string(rune('a'+i%26))+string(rune('a'+i/26))+"@acme.com")
+	}
+	upns[44] = "nophoto@acme.com"
+	infos, err := c.GetUserPhotoInfoBatch(upns)
+	if len(sizes) != 3 || sizes[0] != 20 || sizes[1] != 20 || sizes[2] != 5 {
+		t.Errorf("batch sizes %v, want [20 20 5]", sizes)
+	}
+	berr, ok := err.(BatchError)
+	if !ok || len(berr) != 1 || berr["nophoto@acme.com"] == nil {
+		t.Errorf("error = %v, want only nophoto@acme.com to fail", err)
+	}
+	if len(infos) != 44 || infos["userab@acme.com"].Height != 48 {
+		t.Errorf("got %d infos: %+v", len(infos), infos["userab@acme.com"])
+	}
+}
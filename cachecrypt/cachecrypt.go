@@ -0,0 +1,137 @@
+// Package cachecrypt provides envelope encryption for the token blobs of distributed token caches.
+// Each blob is encrypted with its own random data key, which is in turn encrypted ("wrapped") by a
+// KeyWrapper: a local key encryption key, or a key management service holding the key.  Blobs are bound
+// to the cache key they are stored under, so that one copied over another account's cannot be opened.
+package cachecrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// KeyWrapper encrypts and decrypts data keys, e.g. with a KMS
+type KeyWrapper interface {
+	WrapKey(ctx context.Context, key []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+type envelope struct {
+	Version int    `json:"v"`
+	Key     []byte `json:"key"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Encrypts plain, to be stored under cacheKey, with a new data key wrapped by kw.  A nil kw returns
+// plain unchanged.
+func Seal(ctx context.Context, kw KeyWrapper, cacheKey string, plain []byte) ([]byte, error) {
+	if kw == nil {
+		return plain, nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrapped, err := kw.WrapKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, data, err := seal(key, plain, additionalData(cacheKey))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{Version: 1, Key: wrapped, Nonce: nonce, Data: data})
+}
+
+// Decrypts a blob made by Seal for cacheKey.  A nil kw returns blob unchanged.
+func Open(ctx context.Context, kw KeyWrapper, cacheKey string, blob []byte) ([]byte, error) {
+	if kw == nil {
+		return blob, nil
+	}
+	var env envelope
+	if err := json.Unmarshal(blob, &env); err != nil || env.Version != 1 {
+		return nil, errors.New("token blob is not encrypted")
+	}
+	key, err := kw.UnwrapKey(ctx, env.Key)
+	if err != nil {
+		return nil, err
+	}
+	return open(key, env.Nonce, env.Data, additionalData(cacheKey))
+}
+
+// additionalData authenticates the cache key along with a blob
+func additionalData(cacheKey string) []byte {
+	return []byte("msgraph token blob v1\x00" + cacheKey)
+}
+
+type aesKeyWrapper struct {
+	kek []byte
+}
+
+// Returns a KeyWrapper using AES-GCM with a local key encryption key of 16, 24 or 32 bytes
+func NewAESKeyWrapper(kek []byte) (KeyWrapper, error) {
+	switch len(kek) {
+	case 16, 24, 32:
+		return aesKeyWrapper{kek: append([]byte(nil), kek...)}, nil
+	}
+	return nil, fmt.Errorf("AES key must be 16, 24 or 32 bytes, not %d", len(kek))
+}
+
+func (w aesKeyWrapper) WrapKey(ctx context.Context, key []byte) ([]byte, error) {
+	nonce, data, err := seal(w.kek, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(nonce, data...), nil
+}
+
+func (w aesKeyWrapper) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	aead, err := newGCM(w.kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key is too short")
+	}
+	return open(w.kek, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+}
+
+func seal(key []byte, plain []byte, ad []byte) (nonce []byte, data []byte, err error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plain, ad), nil
+}
+
+func open(key []byte, nonce []byte, data []byte, ad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("token blob is corrupt")
+	}
+	plain, err := aead.Open(nil, nonce, data, ad)
+	if err != nil {
+		return nil, errors.New("token blob cannot be decrypted, wrong key?")
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
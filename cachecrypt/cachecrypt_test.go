@@ -0,0 +1,41 @@
+package cachecrypt
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	ctx := context.Background()
+	kw, err := NewAESKeyWrapper(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := []byte(`{"refresh_token":"secret"}`)
+	blob, err := Seal(ctx, kw, "tenant/client/alice", plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(blob, []byte("secret")) {
+		t.Error("blob contains the plain text")
+	}
+	got, err := Open(ctx, kw, "tenant/client/alice", blob)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("Open() = %s, %v", got, err)
+	}
+
+	other, _ := NewAESKeyWrapper(bytes.Repeat([]byte{2}, 32))
+	if _, err = Open(ctx, other, "tenant/client/alice", blob); err == nil {
+		t.Error("Open() with the wrong key succeeded")
+	}
+	if _, err = Open(ctx, kw, "tenant/client/mallory", blob); err == nil {
+		t.Error("Open() of a blob stored under another cache key succeeded")
+	}
+	if _, err = Open(ctx, kw, "tenant/client/alice", plain); err == nil {
+		t.Error("Open() of an unencrypted blob succeeded")
+	}
+	if _, err = NewAESKeyWrapper([]byte("short")); err == nil {
+		t.Error("NewAESKeyWrapper() accepted a short key")
+	}
+}
@@ -42,6 +42,7 @@ type Event struct {
 	CreatedDateTime            time.Time            `json:"createdDateTime"`
 	LastModifiedDateTime       time.Time            `json:"lastModifiedDateTime"`
 	ChangeKey                  string               `json:"changeKey"`
+	ETag                       string               `json:"@odata.etag,omitempty"`
 	Categories                 []string             `json:"categories"`
 	OriginalStartTimeZone      string               `json:"originalStartTimeZone"`
 	OriginalEndTimeZone        string               `json:"originalEndTimeZone"`
@@ -80,6 +81,29 @@ type Event struct {
 	//UID                        string        `json:"uid"`
 }
 
+// EventUpdate holds the properties to change with UpdateEvent; nil fields are left unchanged
+type EventUpdate struct {
+	AllowNewTimeProposals      *bool                `json:"allowNewTimeProposals,omitempty"`
+	Attendees                  *[]Attendee          `json:"attendees,omitempty"`
+	Body                       *ItemBody            `json:"body,omitempty"`
+	Categories                 *[]string            `json:"categories,omitempty"`
+	End                        *DateTimeTimeZone    `json:"end,omitempty"`
+	Importance                 *string              `json:"importance,omitempty"`
+	IsAllDay                   *bool                `json:"isAllDay,omitempty"`
+	IsOnlineMeeting            *bool                `json:"isOnlineMeeting,omitempty"`
+	IsReminderOn               *bool                `json:"isReminderOn,omitempty"`
+	Location                   *Location            `json:"location,omitempty"`
+	Locations                  *[]Location          `json:"locations,omitempty"`
+	OnlineMeetingProvider      *string              `json:"onlineMeetingProvider,omitempty"`
+	Recurrence                 *PatternedRecurrence `json:"recurrence,omitempty"`
+	ReminderMinutesBeforeStart *int                 `json:"reminderMinutesBeforeStart,omitempty"`
+	ResponseRequested          *bool                `json:"responseRequested,omitempty"`
+	Sensitivity                *string              `json:"sensitivity,omitempty"`
+	ShowAs                     *string              `json:"showAs,omitempty"`
+	Start                      *DateTimeTimeZone    `json:"start,omitempty"`
+	Subject                    *string              `json:"subject,omitempty"`
+}
+
 type PhysicalAddress struct {
 	City            string `json:"city"`
 	CountryOrRegion string `json:"countryOrRegion"`
@@ -160,35 +184,20 @@ type RecurrenceRange struct {
 }
 
 func (c *Client) ListCalendars(upn string, options ...ApiOption) ([]Calendar, error) {
-	var (
-		err error
-	)
-
-	apiUrl, err := formatOptions("https://graph.microsoft.com/v1.0/users/"+url.PathEscape(upn)+"/calendars",
-		options)
+	p, err := c.ListCalendarsPager(upn, options...)
 	if err != nil {
 		return nil, err
 	}
-	list := make([]Calendar, 0, 8)
-	headers := make(map[string]string)
-	err2 := c.executeGetList(apiUrl, headers, func(body io.Reader) string {
-		var (
-			reply struct {
-				Context  string     `json:"@odata.context"`
-				Nextlink string     `json:"@odata.nextLink"`
-				Data     []Calendar `json:"value"`
-			}
-		)
-		if err = json.NewDecoder(body).Decode(&reply); err == nil {
-			list = append(list, reply.Data...)
-			return reply.Nextlink
-		}
-		return ""
-	})
-	if err == nil {
-		err = err2
+	return p.Collect()
+}
+
+func (c *Client) ListCalendarsPager(upn string, options ...ApiOption) (*Pager[Calendar], error) {
+	apiUrl, err := formatOptions(c.graphUrl("/users/"+url.PathEscape(upn)+"/calendars"),
+		options...)
+	if err != nil {
+		return nil, err
 	}
-	return list, err
+	return newPager[Calendar](c, apiUrl, options), nil
 }
 
 // Get a Calendar object for a user or the default calendar of an Office 365 Group.
@@ -201,7 +210,7 @@ func (c *Client) GetCalendar(upn string, calendarId string, calendarGroupId stri
 		err error
 		cal Calendar
 	)
-	apiUrl := "https://graph.microsoft.com/v1.0/users/" + url.PathEscape(upn)
+	apiUrl := c.graphUrl("/users/" + url.PathEscape(upn))
 	if len(calendarGroupId) > 0 {
 		// Specified a calendarGroup ID, so we either get the default calendar in the default calendarGroup
 		// or we get a specific calendar from a specific calendarGroup
@@ -227,6 +236,35 @@ func (c *Client) GetCalendar(upn string, calendarId string, calendarGroupId stri
 	return nil, err
 }
 
+// Update properties of an event in a user's calendar, returning the updated event.
+// Only the non-nil fields of update are changed.  Pass e.IfMatch() as an option to fail with
+// ErrConflict if the event was changed since it was read.
+func (c *Client) UpdateEvent(upn string, eventId string, update EventUpdate, options ...ApiOption) (*Event, error) {
+	var event Event
+	apiUrl, err := formatOptions(c.graphUrl("/users/"+url.PathEscape(upn)+"/events/"+url.PathEscape(eventId)), options...)
+	if err != nil {
+		return nil, err
+	}
+	err = c.executePatch(apiUrl, getHeaders(options), update, func(reader io.Reader) error {
+		return json.NewDecoder(reader).Decode(&event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Delete an event from a user's calendar.  Pass e.IfMatch() as an option to only delete the event
+// if it hasn't been changed since it was read.
+func (c *Client) DeleteEvent(upn string, eventId string, options ...ApiOption) error {
+	return c.executeDelete(c.graphUrl("/users/"+url.PathEscape(upn)+"/events/"+url.PathEscape(eventId)), getHeaders(options))
+}
+
+// Returns an option making an update or delete conditional on the event being unchanged since it was read
+func (e Event) IfMatch() ApiOption {
+	return optionIfMatchItem(e.ETag, e.ChangeKey)
+}
+
 // Get the default Calendar object for an Office 365 Group.
 // Must specify a UserPrincipalName (e.g. "bob@acme.com") or Id (UUID).
 func (c *Client) GetGroupCalendar(upn string) (*Calendar, error) {
@@ -234,7 +272,7 @@ func (c *Client) GetGroupCalendar(upn string) (*Calendar, error) {
 		err error
 		cal Calendar
 	)
-	apiUrl := "https://graph.microsoft.com/v1.0/groups/" + url.PathEscape(upn) + "/calendar"
+	apiUrl := c.graphUrl("/groups/" + url.PathEscape(upn) + "/calendar")
 	err = c.executeGet(apiUrl, func(reader io.Reader) error {
 		return json.NewDecoder(reader).Decode(&cal)
 	})
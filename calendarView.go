@@ -1,8 +1,6 @@
 package msgraph
 
 import (
-	"encoding/json"
-	"io"
 	"net/url"
 )
 
@@ -10,36 +8,18 @@ import (
 // from a user's default calendar (../me/calendarview) or some other calendar of the user's.
 // Must specify a UserPrincipalName (e.g. "bob@acme.com") or User Id (UUID).
 func (c *Client) GetCalendarView(upn string, options ...ApiOption) ([]Event, error) {
-	var (
-		err error
-	)
-
-	apiUrl, err := formatOptions("https://graph.microsoft.com/v1.0/users/"+url.PathEscape(upn)+"/calendarView",
-		options)
+	p, err := c.GetCalendarViewPager(upn, options...)
 	if err != nil {
 		return nil, err
 	}
-	events := make([]Event, 0, 128)
-	headers := make(map[string]string)
-	if getTextMailBody(options) {
-		headers["Prefer"] = `outlook.body-content-type="text"`
-	}
-	err2 := c.executeGetList(apiUrl, headers, func(body io.Reader) string {
-		var (
-			reply struct {
-				Context  string  `json:"@odata.context"`
-				Nextlink string  `json:"@odata.nextLink"`
-				Data     []Event `json:"value"`
-			}
-		)
-		if err = json.NewDecoder(body).Decode(&reply); err == nil {
-			events = append(events, reply.Data...)
-			return reply.Nextlink
-		}
-		return ""
-	})
-	if err == nil {
-		err = err2
+	return p.Collect()
+}
+
+func (c *Client) GetCalendarViewPager(upn string, options ...ApiOption) (*Pager[Event], error) {
+	apiUrl, err := formatOptions(c.graphUrl("/users/"+url.PathEscape(upn)+"/calendarView"),
+		options...)
+	if err != nil {
+		return nil, err
 	}
-	return events, err
+	return newPager[Event](c, apiUrl, options), nil
 }
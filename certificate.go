@@ -0,0 +1,215 @@
+package msgraph
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"golang.org/x/oauth2"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// Creates a new MSGraph API Client using the Client Credentials Grant flow, authenticating with a certificate
+// rather than a shared secret [see https://docs.microsoft.com/en-us/azure/active-directory/develop/active-directory-certificate-credentials].
+// The certificate must be uploaded to the App Registration; LoadCertificate reads the certificate and key from PEM or PKCS#12.
+func NewCertificateClient(ctx context.Context, TenantID string, ClientID string, cert *x509.Certificate, key crypto.Signer,
+	options ...ClientOption) (*Client, error) {
+	if cert == nil || key == nil {
+		return nil, errors.New("a certificate and private key are required")
+	}
+	if _, err := assertionAlgorithm(key); err != nil {
+		return nil, err
+	}
+	c := newClient(ctx, AuthTypeCertificate, TenantID, options)
+	c.ccConfig.ClientID = ClientID
+	c.ccConfig.TokenURL = c.authEndpoint().TokenURL
+	c.ccConfig.Scopes = append(c.ccConfig.Scopes, c.graphScope())
+	c.ccConfig.AuthStyle = oauth2.AuthStyleInParams
+	c.credential = newCredential(func(ctx context.Context) (*oauth2.Token, error) {
+		params, err := certificateParams(cert, key, ClientID, c.ccConfig.TokenURL)
+		if err != nil {
+			return nil, err
+		}
+		cfg := c.ccConfig
+		cfg.EndpointParams = params
+		return cfg.Token(c.oauthContext(ctx))
+	})
+	return c, nil
+}
+
+// Reads a certificate and its private key from PEM, which must hold both, or from PKCS#12 (a .pfx file).
+// The password decrypts PKCS#12 data and is otherwise ignored.  RSA and ECDSA keys are supported.
+func LoadCertificate(data []byte, password string) (*x509.Certificate, crypto.Signer, error) {
+	block, rest := pem.Decode(data)
+	if block == nil {
+		key, cert, _, err := pkcs12.DecodeChain(data, password)
+		if err != nil {
+			return nil, nil, fmt.Errorf("not PEM or PKCS#12: %w", err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return cert, signer, nil
+	}
+	var (
+		cert   *x509.Certificate
+		signer crypto.Signer
+		err    error
+	)
+	for ; block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "CERTIFICATE":
+			// the first certificate is the leaf, any others are its chain
+			if cert == nil {
+				cert, err = x509.ParseCertificate(block.Bytes)
+			}
+		case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY":
+			signer, err = parsePrivateKey(block.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			err = errors.New("encrypted PEM private keys are not supported, use PKCS#12")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if cert == nil {
+		return nil, nil, errors.New("no certificate found")
+	}
+	if signer == nil {
+		return nil, nil, errors.New("no private key found")
+	}
+	return cert, signer, nil
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// certificateParams authenticates a token request with a new assertion, as each may only be used once
+func certificateParams(cert *x509.Certificate, key crypto.Signer, clientID string, tokenURL string) (url.Values, error) {
+	assertion, err := clientAssertion(cert, key, clientID, tokenURL)
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"client_assertion_type": {clientAssertionType},
+		"client_assertion":      {assertion},
+	}, nil
+}
+
+// clientAssertion builds the signed JWT which proves possession of the certificate's key
+func clientAssertion(cert *x509.Certificate, key crypto.Signer, clientID string, audience string) (string, error) {
+	alg, err := assertionAlgorithm(key)
+	if err != nil {
+		return "", err
+	}
+	sha1Thumb := sha1.Sum(cert.Raw)
+	sha256Thumb := sha256.Sum256(cert.Raw)
+	header := map[string]string{
+		"alg":      alg.name,
+		"typ":      "JWT",
+		"x5t":      base64.RawURLEncoding.EncodeToString(sha1Thumb[:]),
+		"x5t#S256": base64.RawURLEncoding.EncodeToString(sha256Thumb[:]),
+	}
+	jti, err := generateNonce(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := map[string]interface{}{
+		"aud": audience,
+		"iss": clientID,
+		"sub": clientID,
+		"jti": jti,
+		"nbf": now.Unix(),
+		"iat": now.Unix(),
+		"exp": now.Add(10 * time.Minute).Unix(),
+	}
+	return signJWT(header, claims, key, alg)
+}
+
+type jwtAlgorithm struct {
+	name string
+	hash crypto.Hash
+	size int // bytes in each of r and s for ECDSA
+}
+
+func assertionAlgorithm(key crypto.Signer) (jwtAlgorithm, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		return jwtAlgorithm{name: "RS256", hash: crypto.SHA256}, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return jwtAlgorithm{name: "ES256", hash: crypto.SHA256, size: 32}, nil
+		case elliptic.P384():
+			return jwtAlgorithm{name: "ES384", hash: crypto.SHA384, size: 48}, nil
+		case elliptic.P521():
+			return jwtAlgorithm{name: "ES512", hash: crypto.SHA512, size: 66}, nil
+		}
+		return jwtAlgorithm{}, fmt.Errorf("unsupported elliptic curve %s", pub.Curve.Params().Name)
+	default:
+		return jwtAlgorithm{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+func signJWT(header map[string]string, claims map[string]interface{}, key crypto.Signer, alg jwtAlgorithm) (string, error) {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	hasher := alg.hash.New()
+	hasher.Write([]byte(signed))
+	sig, err := key.Sign(rand.Reader, hasher.Sum(nil), alg.hash)
+	if err != nil {
+		return "", err
+	}
+	if alg.size > 0 {
+		// crypto.Signer gives ASN.1, JWS wants r and s concatenated
+		var rs struct{ R, S *big.Int }
+		if _, err = asn1.Unmarshal(sig, &rs); err != nil {
+			return "", err
+		}
+		sig = make([]byte, 2*alg.size)
+		rs.R.FillBytes(sig[:alg.size])
+		rs.S.FillBytes(sig[alg.size:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,172 @@
+package msgraph
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+func testCertificate(t *testing.T, key crypto.Signer) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "msgraph test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestLoadCertificate(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecCert := testCertificate(t, ecKey)
+	rsaCert := testCertificate(t, rsaKey)
+
+	ecDer, _ := x509.MarshalECPrivateKey(ecKey)
+	ecPem := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ecCert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDer})...)
+	rsaPfx, err := pkcs12.Modern.Encode(rsaKey, rsaCert, nil, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		password string
+		want     *x509.Certificate
+		wantErr  bool
+	}{
+		{"pem", ecPem, "", ecCert, false},
+		{"pkcs12", rsaPfx, "secret", rsaCert, false},
+		{"pkcs12 wrong password", rsaPfx, "guess", nil, true},
+		{"pem without key", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ecCert.Raw}), "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, key, err := LoadCertificate(tt.data, tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (!cert.Equal(tt.want) || key == nil) {
+				t.Errorf("LoadCertificate() returned the wrong certificate")
+			}
+		})
+	}
+}
+
+func TestNewCertificateClient(t *testing.T) {
+	for _, keyType := range []string{"rsa", "ecdsa"} {
+		t.Run(keyType, func(t *testing.T) {
+			var key crypto.Signer
+			if keyType == "rsa" {
+				key, _ = rsa.GenerateKey(rand.Reader, 2048)
+			} else {
+				key, _ = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+			}
+			cert := testCertificate(t, key)
+			var tokenCalls int
+			var srv *httptest.Server
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/token") {
+					tokenCalls++
+					if err := verifyAssertion(r.FormValue("client_assertion"), cert, srv.URL+r.URL.Path); err != nil {
+						t.Errorf("bad client assertion: %v", err)
+					}
+					if r.FormValue("client_assertion_type") != clientAssertionType || r.FormValue("client_id") != "client" {
+						t.Errorf("unexpected token request %v", r.Form)
+					}
+					w.Header().Set("Content-Type", "application/json")
+					io.WriteString(w, `{"access_token":"abc","token_type":"Bearer","expires_in":3600}`)
+					return
+				}
+				if r.Header.Get("Authorization") != "Bearer abc" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				io.WriteString(w, `{"id":"1"}`)
+			}))
+			defer srv.Close()
+
+			c, err := NewCertificateClient(context.Background(), "tenant", "client", cert, key,
+				WithAuthorityHost(srv.URL), WithGraphEndpoint(srv.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				if err = c.Do(Request{Path: "/me"}, nil); err != nil {
+					t.Fatalf("Do() error = %v", err)
+				}
+			}
+			if tokenCalls != 1 {
+				t.Errorf("token requested %d times, want 1", tokenCalls)
+			}
+		})
+	}
+}
+
+func verifyAssertion(assertion string, cert *x509.Certificate, audience string) error {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return io.ErrUnexpectedEOF
+	}
+	var header map[string]string
+	var claims map[string]interface{}
+	h, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	p, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if err := json.Unmarshal(h, &header); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(p, &claims); err != nil {
+		return err
+	}
+	thumb := sha256.Sum256(cert.Raw)
+	if header["x5t#S256"] != base64.RawURLEncoding.EncodeToString(thumb[:]) || len(header["x5t"]) == 0 {
+		return x509.ErrUnsupportedAlgorithm
+	}
+	if claims["aud"] != audience || claims["iss"] != "client" || claims["sub"] != "client" {
+		return x509.ErrUnsupportedAlgorithm
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+	case *ecdsa.PublicKey:
+		hasher := crypto.SHA384.New()
+		hasher.Write(signed)
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		if header["alg"] != "ES384" || !ecdsa.Verify(pub, hasher.Sum(nil), r, s) {
+			return x509.ErrUnsupportedAlgorithm
+		}
+	}
+	return nil
+}
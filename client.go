@@ -5,8 +5,6 @@ import (
 	"context"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
-	"golang.org/x/oauth2/microsoft"
 	"io"
 	"io/ioutil"
 	"log"
@@ -21,16 +19,34 @@ import (
 const (
 	AuthTypeClientKey = iota
 	AuthTypeAuthCode
+	AuthTypeCertificate
+	AuthTypeDeviceCode
+	AuthTypeOnBehalfOf
+	AuthTypeManagedIdentity
+	AuthTypeWorkloadIdentity
 )
 
 type Client struct {
-	authType    int
-	OauthConfig oauth2.Config
-	token       *oauth2.Token
-	ccConfig    clientcredentials.Config
-	parentCtx   context.Context
-	callTimeout time.Duration
-	apilog      *log.Logger
+	authType      int
+	OauthConfig   oauth2.Config
+	token         *oauth2.Token
+	ccConfig      clientcredentials.Config
+	credential    *credential
+	account       Account
+	identityURL   string
+	login         loginOptions
+	tenantID      string
+	authorityHost string
+	graphEndpoint string
+	apiVersion    string
+	parentCtx     context.Context
+	callTimeout   time.Duration
+	apilog        *log.Logger
+	retry         RetryPolicy
+	transport     http.RoundTripper
+	middleware    []Middleware
+	logger        *apiLogger
+	hooks         Hooks
 }
 
 type TokenCache interface {
@@ -38,59 +54,38 @@ type TokenCache interface {
 	Save(c *Client, token *oauth2.Token) error
 }
 
-type MsGraphError struct {
-	HttpStatusCode int
-	HttpStatus     string
-	Message        string
-}
-
-type msGraphError struct {
-	Error struct {
-		Code    string `json:"code"`
-		Message string `json:"message"`
-	} `json:"error"`
-}
-
-func (e *MsGraphError) Error() string {
-	if len(e.Message) > 0 {
-		return e.Message
-	}
-	return e.HttpStatus
-}
-
-// Gets the HTTP Status code returned if there was an error
-func (e *MsGraphError) StatusCode() int {
-	return e.HttpStatusCode
-}
-
 func (c *Client) getHttpClient(ctx context.Context) *http.Client {
+	ctx = c.oauthContext(ctx)
+	if c.credential != nil {
+		return c.withMiddleware(oauth2.NewClient(ctx, tokenSource{ctx: ctx, cr: c.credential}))
+	}
 	if c.authType == AuthTypeClientKey {
-		return c.ccConfig.Client(ctx)
+		return c.withMiddleware(c.ccConfig.Client(ctx))
 	}
-	return c.OauthConfig.Client(ctx, c.token)
+	return c.withMiddleware(c.OauthConfig.Client(ctx, c.token))
 }
 
 // GetList is specialized in that we get back paged results from MSGraph API
 // We need to detect this and keep calling back for the next page.
 // This function wraps all that logic with the supplied parser controlling
-// and early stop or continuation by returning the NextLink parameter
+// and early stop or continuation by returning the NextLink parameter.
+// Each page is retried independently, so a throttled page is requested again
+// using the same NextLink rather than restarting the listing.
 func (c *Client) executeGetList(apiUrl string, headers map[string]string, parser func(io.Reader) string) error {
-	for {
-		var (
-			req *http.Request
-			res *http.Response
-			err error
-		)
-		ctx, _ := context.WithTimeout(c.parentCtx, c.callTimeout)
-		httpClient := c.getHttpClient(ctx)
-		req, err = http.NewRequest("GET", apiUrl, nil)
-		if headers != nil {
-			for k, v := range headers {
-				req.Header.Add(k, v)
-			}
-		}
-		res, err = httpClient.Do(req)
+	return c.executeGetPages(apiUrl, 1, headers, parser)
+}
+
+// executeGetPages is executeGetList for a listing whose earlier pages were fetched by previous calls,
+// so that requests carry their page number
+func (c *Client) executeGetPages(apiUrl string, page int, headers map[string]string, parser func(io.Reader) string) (err error) {
+	callCtx, done := c.startCall(c.parentCtx, "GET", apiUrl)
+	defer func() { done(err) }()
+	for ; len(apiUrl) > 0; page++ {
+		var res *http.Response
+		ctx, cancel := context.WithTimeout(callCtx, c.callTimeout)
+		res, err = c.send(context.WithValue(ctx, pageKey, page), "GET", apiUrl, headers, nil)
 		if err != nil {
+			cancel()
 			return err
 		}
 		if res.StatusCode == 200 {
@@ -105,45 +100,40 @@ func (c *Client) executeGetList(apiUrl string, headers map[string]string, parser
 			}
 			apiUrl = parser(res.Body)
 			_ = res.Body.Close()
-			if len(apiUrl) == 0 {
-				break
-			}
+			cancel()
 		} else {
 			// api call failure
-			var mserr msGraphError
-			err = json.NewDecoder(res.Body).Decode(&mserr)
-			_ = res.Body.Close()
-			if err == nil {
-				return &MsGraphError{
-					HttpStatusCode: res.StatusCode,
-					HttpStatus:     res.Status,
-					Message:        mserr.Error.Message,
-				}
-			}
-			return errors.New(res.Status)
+			err = c.executeProcessResult(res, nil)
+			cancel()
+			return err
 		}
 	}
 	return nil
 }
 
 func (c *Client) executePost(apiUrl string, body interface{}, parser func(io.Reader) error) error {
-	ctx, _ := context.WithTimeout(c.parentCtx, c.callTimeout)
-	httpClient := c.getHttpClient(ctx)
-	pr, pw := io.Pipe()
-	go func() {
-		_ = json.NewEncoder(pw).Encode(body)
-		pw.Close()
-	}()
-	req, err := http.NewRequest("POST", apiUrl, pr)
+	return c.executeJson("POST", apiUrl, nil, body, parser)
+}
+
+func (c *Client) executePatch(apiUrl string, headers map[string]string, body interface{}, parser func(io.Reader) error) error {
+	return c.executeJson("PATCH", apiUrl, headers, body, parser)
+}
+
+func (c *Client) executePut(apiUrl string, contentType string, body []byte, parser func(io.Reader) error) error {
+	return c.executeRequest("PUT", apiUrl, map[string]string{"Content-Type": contentType}, body, parser)
+}
+
+// executeJson sends body encoded as JSON
+func (c *Client) executeJson(method string, apiUrl string, headers map[string]string, body interface{}, parser func(io.Reader) error) error {
+	data, err := json.Marshal(body)
 	if err != nil {
 		return err
 	}
-	req.Header.Add("Content-Type", "application/json")
-	if res, err := httpClient.Do(req); err != nil {
-		return err
-	} else {
-		return c.executeProcessResult(res, parser)
+	h := map[string]string{"Content-Type": "application/json"}
+	for k, v := range headers {
+		h[k] = v
 	}
+	return c.executeRequest(method, apiUrl, h, data, parser)
 }
 
 func (c *Client) executeGetJson(apiUrl string, output interface{}) error {
@@ -157,20 +147,22 @@ func (c *Client) executeGet(apiUrl string, parser func(io.Reader) error) error {
 	return c.executeMethod("GET", apiUrl, parser)
 }
 
-func (c *Client) executeDelete(apiUrl string) error {
-	return c.executeMethod("DELETE", apiUrl, func(reader io.Reader) error {
+func (c *Client) executeDelete(apiUrl string, headers map[string]string) error {
+	return c.executeRequest("DELETE", apiUrl, headers, nil, func(reader io.Reader) error {
 		return nil
 	})
 }
 
 func (c *Client) executeMethod(method string, apiUrl string, parser func(io.Reader) error) error {
-	ctx, _ := context.WithTimeout(c.parentCtx, c.callTimeout)
-	httpClient := c.getHttpClient(ctx)
-	req, err := http.NewRequest(method, apiUrl, nil)
-	if err != nil {
-		return err
-	}
-	if res, err := httpClient.Do(req); err != nil {
+	return c.executeRequest(method, apiUrl, nil, nil, parser)
+}
+
+func (c *Client) executeRequest(method string, apiUrl string, headers map[string]string, body []byte, parser func(io.Reader) error) (err error) {
+	callCtx, done := c.startCall(c.parentCtx, method, apiUrl)
+	defer func() { done(err) }()
+	ctx, cancel := context.WithTimeout(callCtx, c.callTimeout)
+	defer cancel()
+	if res, err := c.send(ctx, method, apiUrl, headers, body); err != nil {
 		return err
 	} else {
 		return c.executeProcessResult(res, parser)
@@ -201,24 +193,47 @@ func (c *Client) executeProcessResult(res *http.Response, parser func(io.Reader)
 		}
 		return err
 	} else if res.StatusCode >= 201 && res.StatusCode <= 299 {
-		return nil
-	} else {
-		var mserr msGraphError
-		if err = json.NewDecoder(res.Body).Decode(&mserr); err == nil {
-			return &MsGraphError{
-				HttpStatusCode: res.StatusCode,
-				HttpStatus:     res.Status,
-				Message:        mserr.Error.Message,
+		// e.g. 201 Created returns the new item, 204 No Content has nothing to parse
+		if parser != nil && res.StatusCode != http.StatusNoContent {
+			err = parser(res.Body)
+			if err == io.EOF {
+				// an empty body, e.g. 202 Accepted, is not an error
+				err = nil
 			}
 		}
-		return errors.New(res.Status)
+		return err
+	} else {
+		return newMsGraphError(res)
 	}
 }
 
+// Log raw response bodies to logger.  See SetLogger for structured logging with redaction.
 func (c *Client) SetAPILogging(logger *log.Logger) {
 	c.apilog = logger
 }
 
+// Returns a copy of the client whose API calls run under ctx instead of the context given at
+// construction, for example the context of an incoming HTTP request:
+//
+//	msgs, err := c.WithContext(r.Context()).ListMessages(upn)
+//
+// Cancelling ctx, or reaching its deadline, aborts the call in progress including any paging,
+// retry waits and token refreshes.  The per call timeout (see SetTimeout) still applies.
+// The copy shares credentials with the original client; settings changed on the copy only apply to it.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	if ctx == nil {
+		panic("nil context")
+	}
+	c2 := *c
+	c2.parentCtx = ctx
+	return &c2
+}
+
+// Returns the context under which API calls are made
+func (c *Client) Context() context.Context {
+	return c.parentCtx
+}
+
 func (c *Client) SetTimeout(timeout time.Duration) {
 	if timeout > 0 {
 		c.callTimeout = timeout
@@ -228,20 +243,34 @@ func (c *Client) SetTimeout(timeout time.Duration) {
 func (c *Client) Close() {
 }
 
+// newClient applies the defaults shared by all authentication flows followed by any ClientOptions
+func newClient(ctx context.Context, authType int, tenantID string, options []ClientOption) *Client {
+	c := new(Client)
+	c.authType = authType
+	c.tenantID = tenantID
+	c.authorityHost = CloudGlobal.AuthorityHost
+	c.graphEndpoint = CloudGlobal.GraphEndpoint
+	c.apiVersion = APIVersionV1
+	c.parentCtx = ctx
+	c.callTimeout = time.Second * 180
+	c.retry = DefaultRetryPolicy
+	for _, o := range options {
+		o(c)
+	}
+	return c
+}
+
 // Creates a new MSGraph API Client using the Client Credentials Grant flow [see https://oauth.net/2/grant-types/client-credentials/]
 // One needs to create the Client ID and Key in Azure AD prior to calling this.
 // All permissions must be added to the Configured Permissions in the App Registration within Azure AD console
 // [see https://docs.microsoft.com/en-us/azure/active-directory/develop/v2-permissions-and-consent#the-default-scope]
-func NewKeyClient(ctx context.Context, TenantID string, ClientID string, ClientKey string) (*Client, error) {
-	c := new(Client)
-	c.authType = AuthTypeClientKey
+func NewKeyClient(ctx context.Context, TenantID string, ClientID string, ClientKey string, options ...ClientOption) (*Client, error) {
+	c := newClient(ctx, AuthTypeClientKey, TenantID, options)
 	c.ccConfig.ClientID = ClientID
 	c.ccConfig.ClientSecret = ClientKey
-	c.ccConfig.TokenURL = "https://login.microsoftonline.com/" + TenantID + "/oauth2/v2.0/token"
-	c.ccConfig.Scopes = append(c.ccConfig.Scopes, "https://graph.microsoft.com/.default")
+	c.ccConfig.TokenURL = c.authEndpoint().TokenURL
+	c.ccConfig.Scopes = append(c.ccConfig.Scopes, c.graphScope())
 	c.ccConfig.AuthStyle = oauth2.AuthStyleInParams
-	c.parentCtx = ctx
-	c.callTimeout = time.Second * 180
 	return c, nil
 }
 
@@ -249,22 +278,20 @@ func NewKeyClient(ctx context.Context, TenantID string, ClientID string, ClientK
 // One needs to create the Client ID and Secret in Azure AD prior to calling this.
 // One or more scopes must be supplied to indicate the type of access being requested.
 // This authentication flow launches a web browser for the OAuth2 work with a callback to
-// a web server at localhost:8001.
+// a web server at localhost:8001, see WithLoginAddress and the other login options to change this.
+// timeout limits the wait for the user to sign in; zero or less waits until ctx is done.
 func NewClient(ctx context.Context, TenantID string, ClientID string, ClientSecret string, scopes []string,
-	cache TokenCache, timeout time.Duration) (*Client, error) {
+	cache TokenCache, timeout time.Duration, options ...ClientOption) (*Client, error) {
 	var (
-		state string
-		err   error
+		code string
+		err  error
 	)
-	c := new(Client)
-	c.authType = AuthTypeAuthCode
+	c := newClient(ctx, AuthTypeAuthCode, TenantID, options)
 	c.OauthConfig.ClientID = ClientID
 	c.OauthConfig.ClientSecret = ClientSecret
-	c.OauthConfig.Endpoint = microsoft.AzureADEndpoint(TenantID)
-	c.OauthConfig.Scopes = append(c.ccConfig.Scopes, "offline_access")
-	c.OauthConfig.Scopes = append(c.ccConfig.Scopes, scopes...)
-	c.parentCtx = ctx
-	c.callTimeout = time.Second * 180
+	c.OauthConfig.Endpoint = c.authEndpoint()
+	c.OauthConfig.Scopes = append(c.OauthConfig.Scopes, "offline_access")
+	c.OauthConfig.Scopes = append(c.OauthConfig.Scopes, scopes...)
 
 	// Load any token which was previously cached
 	if cache == nil {
@@ -272,24 +299,20 @@ func NewClient(ctx context.Context, TenantID string, ClientID string, ClientSecr
 	}
 	c.token, err = cache.Load(c)
 	if err == nil {
+		c.account, _ = accountFromToken(c.token)
+		c.persist(cache)
 		return c, nil
 	}
-	state, err = generateNonce(16)
-	if err == nil {
-		err = openUrl(c.OauthConfig.AuthCodeURL(state, oauth2.AccessTypeOffline))
-	}
+	code, err = c.interactiveLogin(ctx, timeout)
 	if err != nil {
 		return nil, err
 	}
-	cbChan := c.startCallbackServer(ctx, state, timeout)
-	cb := <-cbChan
-	if cb.err != nil {
-		return nil, cb.err
-	}
-	c.token, err = c.OauthConfig.Exchange(ctx, cb.code)
+	c.token, err = c.OauthConfig.Exchange(c.oauthContext(ctx), code)
 	if err != nil {
 		return nil, err
 	}
+	c.account, _ = accountFromToken(c.token) // only if the openid scope was requested
 	err = cache.Save(c, c.token)
+	c.persist(cache)
 	return c, nil
 }
@@ -0,0 +1,62 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClient_WithContext_pagedList(t *testing.T) {
+	var (
+		base   string
+		cancel context.CancelFunc
+		pages  []string
+	)
+	c, srv := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		pages = append(pages, r.URL.Query().Get("page"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"value":           []interface{}{map[string]string{"id": "m1"}},
+			"@odata.nextLink": base + "/v1.0/users/bob/messages?page=2",
+		})
+		cancel() // the caller gives up while the first page is being delivered
+	})
+	base = srv.URL
+	ctx, cancelFn := context.WithCancel(context.Background())
+	cancel = cancelFn
+
+	_, err := c.WithContext(ctx).ListMessages("bob")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ListMessages() error = %v, want context.Canceled", err)
+	}
+	if len(pages) != 1 {
+		t.Errorf("requested pages %v after cancelling, want only the first", pages)
+	}
+	if c.Context().Err() != nil {
+		t.Error("cancelling the copy's context affected the original client")
+	}
+}
+
+func TestClient_WithContext_retryWait(t *testing.T) {
+	var calls int
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error":{"code":"TooManyRequests","message":"slow down"}}`)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := c.WithContext(ctx).GetFolder("bob", "inbox")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetFolder() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second || calls != 1 {
+		t.Errorf("returned after %v and %d calls, want the 30s Retry-After wait interrupted", elapsed, calls)
+	}
+}
@@ -0,0 +1,90 @@
+package msgraph
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	APIVersionV1   = "v1.0"
+	APIVersionBeta = "beta"
+)
+
+// Cloud identifies the Azure AD authority and the Graph endpoint for one of the
+// Microsoft cloud deployments.  There is no Cloud for Germany: Microsoft Cloud Deutschland was
+// closed in October 2021 and its tenants moved to the global cloud, so use CloudGlobal for them.
+// See https://docs.microsoft.com/en-us/graph/deployments
+type Cloud struct {
+	AuthorityHost string // e.g. https://login.microsoftonline.com
+	GraphEndpoint string // e.g. https://graph.microsoft.com
+}
+
+var (
+	CloudGlobal  = Cloud{AuthorityHost: "https://login.microsoftonline.com", GraphEndpoint: "https://graph.microsoft.com"}
+	CloudUSGovL4 = Cloud{AuthorityHost: "https://login.microsoftonline.us", GraphEndpoint: "https://graph.microsoft.us"}
+	CloudUSGovL5 = Cloud{AuthorityHost: "https://login.microsoftonline.us", GraphEndpoint: "https://dod-graph.microsoft.us"}
+	CloudChina   = Cloud{AuthorityHost: "https://login.chinacloudapi.cn", GraphEndpoint: "https://microsoftgraph.chinacloudapi.cn"}
+)
+
+// ClientOption configures a Client while it is being constructed.
+type ClientOption func(*Client)
+
+// Use the authority and Graph endpoint of the given cloud rather than the global Azure cloud.
+func WithCloud(cloud Cloud) ClientOption {
+	return func(c *Client) {
+		c.authorityHost = strings.TrimRight(cloud.AuthorityHost, "/")
+		c.graphEndpoint = strings.TrimRight(cloud.GraphEndpoint, "/")
+	}
+}
+
+// Send all API calls to endpoint (e.g. "https://graph.microsoft.us" or "http://localhost:8080" for
+// a fake Graph server) instead of the endpoint of the selected cloud.
+func WithGraphEndpoint(endpoint string) ClientOption {
+	return func(c *Client) {
+		c.graphEndpoint = strings.TrimRight(endpoint, "/")
+	}
+}
+
+// Obtain tokens from host (e.g. "https://login.microsoftonline.us") instead of the
+// authority of the selected cloud.
+func WithAuthorityHost(host string) ClientOption {
+	return func(c *Client) {
+		c.authorityHost = strings.TrimRight(host, "/")
+	}
+}
+
+// Select the Graph API version, APIVersionV1 (the default) or APIVersionBeta.
+func WithAPIVersion(version string) ClientOption {
+	return func(c *Client) {
+		c.apiVersion = version
+	}
+}
+
+// Switch the Graph API version used for subsequent calls, APIVersionV1 or APIVersionBeta.
+func (c *Client) SetAPIVersion(version string) {
+	if len(version) > 0 {
+		c.apiVersion = version
+	}
+}
+
+// graphUrl returns the absolute URL of an API path such as "/users/bob@acme.com/messages"
+func (c *Client) graphUrl(path string) string {
+	return c.graphEndpoint + "/" + c.apiVersion + path
+}
+
+// graphScope is the static scope requesting all permissions configured for the application
+func (c *Client) graphScope() string {
+	return c.graphEndpoint + "/.default"
+}
+
+// authEndpoint returns the v2.0 OAuth2 endpoints of the client's tenant on the selected authority
+func (c *Client) authEndpoint() oauth2.Endpoint {
+	base := c.authorityHost + "/" + url.PathEscape(c.tenantID) + "/oauth2/v2.0"
+	return oauth2.Endpoint{
+		AuthURL:       base + "/authorize",
+		TokenURL:      base + "/token",
+		DeviceAuthURL: base + "/devicecode",
+	}
+}
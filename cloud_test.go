@@ -0,0 +1,82 @@
+package msgraph
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCloudOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   []ClientOption
+		graphUrl  string
+		tokenUrl  string
+		scope     string
+		deviceUrl string
+	}{
+		{
+			name:      "default",
+			graphUrl:  "https://graph.microsoft.com/v1.0/me",
+			tokenUrl:  "https://login.microsoftonline.com/tenant/oauth2/v2.0/token",
+			scope:     "https://graph.microsoft.com/.default",
+			deviceUrl: "https://login.microsoftonline.com/tenant/oauth2/v2.0/devicecode",
+		},
+		{
+			name:     "cloud",
+			options:  []ClientOption{WithCloud(CloudUSGovL5)},
+			graphUrl: "https://dod-graph.microsoft.us/v1.0/me",
+			tokenUrl: "https://login.microsoftonline.us/tenant/oauth2/v2.0/token",
+			scope:    "https://dod-graph.microsoft.us/.default",
+		},
+		{
+			name:     "cloud then overrides",
+			options:  []ClientOption{WithCloud(CloudChina), WithGraphEndpoint("http://localhost:8080/"), WithAPIVersion(APIVersionBeta)},
+			graphUrl: "http://localhost:8080/beta/me",
+			tokenUrl: "https://login.chinacloudapi.cn/tenant/oauth2/v2.0/token",
+			scope:    "http://localhost:8080/.default",
+		},
+		{
+			name:     "later cloud replaces overrides",
+			options:  []ClientOption{WithAuthorityHost("http://localhost:9090/"), WithCloud(CloudUSGovL4)},
+			graphUrl: "https://graph.microsoft.us/v1.0/me",
+			tokenUrl: "https://login.microsoftonline.us/tenant/oauth2/v2.0/token",
+			scope:    "https://graph.microsoft.us/.default",
+		},
+		{
+			name:     "authority override",
+			options:  []ClientOption{WithAuthorityHost("http://localhost:9090/")},
+			graphUrl: "https://graph.microsoft.com/v1.0/me",
+			tokenUrl: "http://localhost:9090/tenant/oauth2/v2.0/token",
+			scope:    "https://graph.microsoft.com/.default",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewKeyClient(context.Background(), "tenant", "client", "secret", tt.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := c.graphUrl("/me"); got != tt.graphUrl {
+				t.Errorf("graphUrl() = %s, want %s", got, tt.graphUrl)
+			}
+			if got := c.authEndpoint().TokenURL; got != tt.tokenUrl {
+				t.Errorf("TokenURL = %s, want %s", got, tt.tokenUrl)
+			}
+			if c.ccConfig.TokenURL != tt.tokenUrl || len(c.ccConfig.Scopes) != 1 || c.ccConfig.Scopes[0] != tt.scope {
+				t.Errorf("client credentials config = %s %v, want %s [%s]", c.ccConfig.TokenURL, c.ccConfig.Scopes, tt.tokenUrl, tt.scope)
+			}
+			if got := c.authEndpoint().DeviceAuthURL; len(tt.deviceUrl) > 0 && got != tt.deviceUrl {
+				t.Errorf("DeviceAuthURL = %s, want %s", got, tt.deviceUrl)
+			}
+		})
+	}
+}
+
+func TestSetAPIVersion(t *testing.T) {
+	c, _ := NewKeyClient(context.Background(), "tenant", "client", "secret")
+	c.SetAPIVersion(APIVersionBeta)
+	c.SetAPIVersion("")
+	if got := c.graphUrl("/me"); got != "https://graph.microsoft.com/beta/me" {
+		t.Errorf("graphUrl() = %s", got)
+	}
+}
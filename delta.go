@@ -0,0 +1,159 @@
+package msgraph
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// DeltaRemoved identifies an item which was deleted, or moved out of the tracked
+// collection, since the previous delta round
+type DeltaRemoved struct {
+	ID     string
+	Reason string // "changed" or "deleted"
+}
+
+// DeltaResult holds the outcome of one delta round [see https://docs.microsoft.com/en-us/graph/delta-query-overview].
+// State is an opaque token to be persisted and passed to the next call of the same delta method
+// to receive only the changes made after this round.
+//
+// A round may span many pages.  If one fails, the items of the pages already fetched are returned
+// along with the error, and State continues the round from the failed page rather than starting it again.
+type DeltaResult[T any] struct {
+	Changed []T
+	Removed []DeltaRemoved
+	State   string
+}
+
+const deltaStatePrefix = "d1."
+
+// Track changes to the messages of a mail folder.  Pass an empty state for the initial round,
+// which returns every message in the folder, and the State of the previous result thereafter.
+// The options (e.g. OptionSelect) only apply to the initial round as they are retained in the state;
+// OptionTextMailBody must be given on every call.  Graph only tracks messages per folder, so folderId
+// is required; well-known names such as "inbox" may be used.
+func (c *Client) MessagesDelta(upn string, folderId string, state string, options ...ApiOption) (*DeltaResult[Message], error) {
+	if len(folderId) == 0 {
+		return nil, fmt.Errorf("a mail folder is required to track messages")
+	}
+	return deltaQuery[Message](c,
+		c.graphUrl("/users/"+url.PathEscape(upn)+"/mailFolders/"+url.PathEscape(folderId)+"/messages/delta"),
+		state, options)
+}
+
+// Track changes to the mail folders of a user
+func (c *Client) MailFoldersDelta(upn string, state string, options ...ApiOption) (*DeltaResult[MailFolder], error) {
+	return deltaQuery[MailFolder](c, c.graphUrl("/users/"+url.PathEscape(upn)+"/mailFolders/delta"), state, options)
+}
+
+// Track changes to the events of a user's default calendar within a time range.  The initial round
+// must supply OptionStartDateTime and OptionEndDateTime.
+func (c *Client) CalendarViewDelta(upn string, state string, options ...ApiOption) (*DeltaResult[Event], error) {
+	return deltaQuery[Event](c, c.graphUrl("/users/"+url.PathEscape(upn)+"/calendarView/delta"), state, options)
+}
+
+// Track changes to the users of the tenant
+func (c *Client) UsersDelta(state string, options ...ApiOption) (*DeltaResult[User], error) {
+	return deltaQuery[User](c, c.graphUrl("/users/delta"), state, options)
+}
+
+// Track changes to the groups of the tenant
+func (c *Client) GroupsDelta(state string, options ...ApiOption) (*DeltaResult[Group], error) {
+	return deltaQuery[Group](c, c.graphUrl("/groups/delta"), state, options)
+}
+
+// deltaQuery follows the nextLinks of a delta round until Graph returns the deltaLink for the
+// following round, splitting the items into changed and removed.  The items of a page are only
+// added once it has been decoded in full, so that a round resumed from the failed page has no duplicates.
+func deltaQuery[T any](c *Client, urlbase string, state string, options []ApiOption) (*DeltaResult[T], error) {
+	var (
+		err    error
+		apiUrl string
+	)
+	if len(state) > 0 {
+		apiUrl, err = decodeDeltaState(state)
+		if err == nil && !strings.HasPrefix(apiUrl, c.graphEndpoint+"/") {
+			// never send our token anywhere other than the Graph endpoint
+			err = fmt.Errorf("delta state is for a different Graph endpoint")
+		}
+	} else {
+		apiUrl, err = formatOptions(urlbase, options...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := &DeltaResult[T]{}
+	pending := apiUrl // the link of the page being fetched
+	err2 := c.executeGetList(apiUrl, getHeaders(options), func(body io.Reader) string {
+		var (
+			reply struct {
+				Nextlink  string            `json:"@odata.nextLink"`
+				Deltalink string            `json:"@odata.deltaLink"`
+				Data      []json.RawMessage `json:"value"`
+			}
+		)
+		if err = json.NewDecoder(body).Decode(&reply); err != nil {
+			return ""
+		}
+		var (
+			changed []T
+			removed []DeltaRemoved
+		)
+		for _, raw := range reply.Data {
+			var marker struct {
+				ID      string `json:"id"`
+				Removed *struct {
+					Reason string `json:"reason"`
+				} `json:"@removed"`
+			}
+			if err = json.Unmarshal(raw, &marker); err != nil {
+				return ""
+			}
+			if marker.Removed != nil {
+				removed = append(removed, DeltaRemoved{ID: marker.ID, Reason: marker.Removed.Reason})
+				continue
+			}
+			var item T
+			if err = json.Unmarshal(raw, &item); err != nil {
+				return ""
+			}
+			changed = append(changed, item)
+		}
+		result.Changed = append(result.Changed, changed...)
+		result.Removed = append(result.Removed, removed...)
+		if len(reply.Deltalink) > 0 {
+			result.State = encodeDeltaState(reply.Deltalink)
+		}
+		pending = reply.Nextlink
+		return reply.Nextlink
+	})
+	if err == nil && err2 != nil {
+		result.State = encodeDeltaState(pending)
+		return result, err2
+	}
+	if err == nil && len(result.State) == 0 {
+		err = fmt.Errorf("delta query ended without a deltaLink")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func encodeDeltaState(link string) string {
+	return deltaStatePrefix + base64.RawURLEncoding.EncodeToString([]byte(link))
+}
+
+func decodeDeltaState(state string) (string, error) {
+	if !strings.HasPrefix(state, deltaStatePrefix) {
+		return "", fmt.Errorf("invalid delta state")
+	}
+	link, err := base64.RawURLEncoding.DecodeString(state[len(deltaStatePrefix):])
+	if err != nil {
+		return "", fmt.Errorf("invalid delta state: %w", err)
+	}
+	return string(link), nil
+}
@@ -0,0 +1,154 @@
+package msgraph
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMessagesDelta(t *testing.T) {
+	var (
+		base     string
+		requests []string
+	)
+	c, srv := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+"?"+r.URL.RawQuery)
+		if r.Header.Get("Prefer") != `outlook.body-content-type="text"` {
+			t.Errorf("Prefer header missing on %s", r.URL)
+		}
+		switch r.URL.Query().Get("token") {
+		case "":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"value":           []interface{}{map[string]string{"id": "m1", "subject": "one"}},
+				"@odata.nextLink": base + "/v1.0/users/bob/mailFolders/inbox/messages/delta?token=page2",
+			})
+		case "page2":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"value": []interface{}{
+					map[string]string{"id": "m2", "subject": "two"},
+					map[string]interface{}{"id": "m0", "@removed": map[string]string{"reason": "deleted"}},
+				},
+				"@odata.deltaLink": base + "/v1.0/users/bob/mailFolders/inbox/messages/delta?token=round2",
+			})
+		case "round2":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"value":            []interface{}{map[string]interface{}{"id": "m1", "@removed": map[string]string{"reason": "changed"}}},
+				"@odata.deltaLink": base + "/v1.0/users/bob/mailFolders/inbox/messages/delta?token=round3",
+			})
+		}
+	})
+	base = srv.URL
+
+	first, err := c.MessagesDelta("bob", "inbox", "", OptionSelect("subject"), OptionTextMailBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 2 || !strings.Contains(requests[0], "%24select=subject") {
+		t.Errorf("unexpected requests %v", requests)
+	}
+	if len(first.Changed) != 2 || first.Changed[1].Subject != "two" ||
+		len(first.Removed) != 1 || first.Removed[0] != (DeltaRemoved{ID: "m0", Reason: "deleted"}) {
+		t.Errorf("unexpected first round %+v", first)
+	}
+
+	second, err := c.MessagesDelta("bob", "inbox", first.State, OptionTextMailBody())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(requests[2], "token=round2") {
+		t.Errorf("state not resumed from the deltaLink: %s", requests[2])
+	}
+	if len(second.Changed) != 0 || len(second.Removed) != 1 || second.Removed[0].Reason != "changed" {
+		t.Errorf("unexpected second round %+v", second)
+	}
+	if link, _ := decodeDeltaState(second.State); link != base+"/v1.0/users/bob/mailFolders/inbox/messages/delta?token=round3" {
+		t.Errorf("State holds %q", link)
+	}
+}
+
+func TestMessagesDelta_invalid(t *testing.T) {
+	var requests int
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	})
+	foreign := deltaStatePrefix + base64.RawURLEncoding.EncodeToString([]byte("https://evil.example.com/v1.0/delta"))
+	for _, tt := range []struct{ folder, state string }{
+		{"", ""},
+		{"inbox", foreign},
+		{"inbox", "not a state"},
+		{"inbox", deltaStatePrefix + "!!"},
+	} {
+		if _, err := c.MessagesDelta("bob", tt.folder, tt.state); err == nil {
+			t.Errorf("MessagesDelta(%q, %q) succeeded", tt.folder, tt.state)
+		}
+	}
+	if requests != 0 {
+		t.Errorf("%d requests sent for invalid arguments", requests)
+	}
+}
+
+func TestUsersDelta(t *testing.T) {
+	var (
+		base     string
+		requests []string
+		failing  = true
+	)
+	c, srv := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query().Get("token"))
+		switch r.URL.Query().Get("token") {
+		case "":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"value": []interface{}{
+					map[string]string{"id": "u1", "displayName": "Bob"},
+					map[string]interface{}{"id": "u0", "@removed": map[string]string{"reason": "changed"}},
+				},
+				"@odata.nextLink": base + "/v1.0/users/delta?token=page2",
+			})
+		case "page2":
+			if failing {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":{"code":"BadRequest","message":"try again"}}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"value": []interface{}{
+					map[string]string{"id": "u2", "displayName": "Jane"},
+					map[string]interface{}{"id": "u3", "@removed": map[string]string{"reason": "deleted"}},
+				},
+				"@odata.deltaLink": base + "/v1.0/users/delta?token=round2",
+			})
+		}
+	})
+	base = srv.URL
+
+	// the second page fails, the first page's changes are kept and the round can be continued
+	partial, err := c.UsersDelta("")
+	if err == nil || partial == nil {
+		t.Fatalf("UsersDelta() = %+v, %v, want the first page and an error", partial, err)
+	}
+	if len(partial.Changed) != 1 || partial.Changed[0].DisplayName != "Bob" ||
+		len(partial.Removed) != 1 || partial.Removed[0] != (DeltaRemoved{ID: "u0", Reason: "changed"}) {
+		t.Errorf("unexpected partial round %+v", partial)
+	}
+	if link, _ := decodeDeltaState(partial.State); link != base+"/v1.0/users/delta?token=page2" {
+		t.Errorf("State of the failed round holds %q, want the failed page", link)
+	}
+
+	failing = false
+	rest, err := c.UsersDelta(partial.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest.Changed) != 1 || rest.Changed[0].ID != "u2" ||
+		len(rest.Removed) != 1 || rest.Removed[0] != (DeltaRemoved{ID: "u3", Reason: "deleted"}) {
+		t.Errorf("unexpected rest of the round %+v", rest)
+	}
+	if link, _ := decodeDeltaState(rest.State); link != base+"/v1.0/users/delta?token=round2" {
+		t.Errorf("State holds %q, want the deltaLink", link)
+	}
+	if strings.Join(requests, ",") != ",page2,page2" {
+		t.Errorf("requested pages %q, want the first page only once", requests)
+	}
+}
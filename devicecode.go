@@ -0,0 +1,67 @@
+package msgraph
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2"
+)
+
+// DeviceCodePrompt tells the user where to sign in and which code to enter.  auth.VerificationURIComplete,
+// when set, already includes the code, e.g. for showing as a QR code.
+type DeviceCodePrompt func(auth *oauth2.DeviceAuthResponse) error
+
+// Create a new MSGraph API Client using the Device Authorization Grant flow [see https://oauth.net/2/device-flow/]
+// for delegated access where no browser can be opened, e.g. over SSH or in a container.  The user signs in on any
+// other device using the code passed to prompt, which prints to stderr if nil, while this polls the token endpoint.
+// The App Registration must allow public client flows.  As with NewClient, a token found in the cache is used
+// without prompting and a new token is saved to it.
+func NewDeviceCodeClient(ctx context.Context, TenantID string, ClientID string, scopes []string, cache TokenCache,
+	prompt DeviceCodePrompt, options ...ClientOption) (*Client, error) {
+	var err error
+	c := newClient(ctx, AuthTypeDeviceCode, TenantID, options)
+	c.OauthConfig.ClientID = ClientID
+	c.OauthConfig.Endpoint = c.authEndpoint()
+	c.OauthConfig.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+	c.OauthConfig.Scopes = append(c.OauthConfig.Scopes, "openid", "profile", "offline_access")
+	c.OauthConfig.Scopes = append(c.OauthConfig.Scopes, scopes...)
+
+	if cache == nil {
+		cache = NullCache{}
+	}
+	c.token, err = cache.Load(c)
+	if err == nil {
+		c.account, _ = accountFromToken(c.token)
+		c.persist(cache)
+		return c, nil
+	}
+	if prompt == nil {
+		prompt = printDeviceCode
+	}
+	octx := c.oauthContext(ctx)
+	auth, err := c.OauthConfig.DeviceAuth(octx)
+	if err != nil {
+		return nil, err
+	}
+	if err = prompt(auth); err != nil {
+		return nil, err
+	}
+	// polls at the interval given by the server, slowing down when asked to, until the user
+	// has signed in, the code expires or ctx is cancelled
+	c.token, err = c.OauthConfig.DeviceAccessToken(octx, auth)
+	if err != nil {
+		return nil, err
+	}
+	c.account, _ = accountFromToken(c.token) // the id_token only names the account, it is not needed to call Graph
+	if err = cache.Save(c, c.token); err != nil {
+		return nil, err
+	}
+	c.persist(cache)
+	return c, nil
+}
+
+func printDeviceCode(auth *oauth2.DeviceAuthResponse) error {
+	_, err := fmt.Fprintf(os.Stderr, "To sign in, open %s and enter the code %s\n", auth.VerificationURI, auth.UserCode)
+	return err
+}
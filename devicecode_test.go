@@ -0,0 +1,101 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+type memoryCache struct {
+	token *oauth2.Token
+}
+
+func (mc *memoryCache) Load(c *Client) (*oauth2.Token, error) {
+	if mc.token == nil {
+		return nil, io.EOF
+	}
+	return mc.token, nil
+}
+
+func (mc *memoryCache) Save(c *Client, token *oauth2.Token) error {
+	mc.token = token
+	return nil
+}
+
+func TestNewDeviceCodeClient(t *testing.T) {
+	var polls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tenant/oauth2/v2.0/devicecode", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"device_code":"dc","user_code":"ABC-123","verification_uri":"https://microsoft.com/devicelogin","expires_in":900,"interval":1}`)
+	})
+	mux.HandleFunc("/tenant/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if r.FormValue("device_code") != "dc" || r.FormValue("client_id") != "client" {
+			t.Errorf("unexpected token request %v", r.Form)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if polls == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"error":"authorization_pending"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "abc", "refresh_token": "def",
+			"token_type": "Bearer", "expires_in": 3600, "id_token": testIDToken(map[string]string{"oid": "u1", "tid": "tenant"})})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var userCode string
+	cache := &memoryCache{}
+	c, err := NewDeviceCodeClient(context.Background(), "tenant", "client", []string{"Mail.Read"}, cache,
+		func(auth *oauth2.DeviceAuthResponse) error {
+			userCode = auth.UserCode
+			return nil
+		}, WithAuthorityHost(srv.URL))
+	if err != nil {
+		t.Fatalf("NewDeviceCodeClient() error = %v", err)
+	}
+	if userCode != "ABC-123" || polls != 2 {
+		t.Errorf("prompted with %q after %d polls, want ABC-123 after 2", userCode, polls)
+	}
+	if c.Account().ID != "u1" {
+		t.Errorf("Account() = %+v, want the id_token's", c.Account())
+	}
+	if cache.token == nil || cache.token.AccessToken != "abc" {
+		t.Errorf("token was not saved to the cache")
+	}
+
+	// a cached token is used without prompting
+	_, err = NewDeviceCodeClient(context.Background(), "tenant", "client", nil, cache,
+		func(auth *oauth2.DeviceAuthResponse) error {
+			t.Error("prompted despite a cached token")
+			return nil
+		}, WithAuthorityHost(srv.URL))
+	if err != nil {
+		t.Fatalf("NewDeviceCodeClient() error = %v", err)
+	}
+
+	// without an id_token the client works but doesn't know its account
+	mux.HandleFunc("/other/oauth2/v2.0/devicecode", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"device_code":"dc","user_code":"ABC-123","verification_uri":"https://microsoft.com/devicelogin","expires_in":900,"interval":1}`)
+	})
+	mux.HandleFunc("/other/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"abc","refresh_token":"def","token_type":"Bearer","expires_in":3600}`)
+	})
+	c, err = NewDeviceCodeClient(context.Background(), "other", "client", nil, &memoryCache{},
+		func(auth *oauth2.DeviceAuthResponse) error { return nil }, WithAuthorityHost(srv.URL))
+	if err != nil {
+		t.Fatalf("NewDeviceCodeClient() without an id_token error = %v", err)
+	}
+	if c.Account() != (Account{}) {
+		t.Errorf("Account() = %+v, want none", c.Account())
+	}
+}
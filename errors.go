@@ -0,0 +1,206 @@
+package msgraph
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinel errors for use with errors.Is, e.g. errors.Is(err, msgraph.ErrNotFound)
+var (
+	ErrNotFound          = errors.New("msgraph: resource not found")
+	ErrThrottled         = errors.New("msgraph: request throttled")
+	ErrAccessDenied      = errors.New("msgraph: access denied")
+	ErrMailboxNotEnabled = errors.New("msgraph: mailbox not enabled for REST API")
+	ErrConflict          = errors.New("msgraph: item was changed by someone else")
+)
+
+// MsGraphError describes a failed Graph API call.  The request IDs should be quoted when
+// raising a support case with Microsoft.
+// See https://docs.microsoft.com/en-us/graph/errors
+type MsGraphError struct {
+	HttpStatusCode  int
+	HttpStatus      string
+	Code            string // Graph error code, e.g. "ErrorItemNotFound"
+	Message         string
+	RequestID       string
+	ClientRequestID string
+	Date            string // the Date header (RFC 1123), or the innerError date (ISO 8601) without one
+	Details         []ErrorDetail
+	InnerError      *InnerError
+	RetryAfter      time.Duration // delay requested by the server, zero if none
+}
+
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Target  string `json:"target"`
+}
+
+type InnerError struct {
+	Code            string      `json:"code"`
+	Message         string      `json:"message"`
+	RequestID       string      `json:"request-id"`
+	ClientRequestID string      `json:"client-request-id"`
+	Date            string      `json:"date"`
+	InnerError      *InnerError `json:"innerError"`
+}
+
+type msGraphError struct {
+	Error struct {
+		Code       string        `json:"code"`
+		Message    string        `json:"message"`
+		Details    []ErrorDetail `json:"details"`
+		InnerError *InnerError   `json:"innerError"`
+	} `json:"error"`
+}
+
+func (e *MsGraphError) Error() string {
+	var b strings.Builder
+	if len(e.Message) > 0 {
+		b.WriteString(e.Message)
+	} else {
+		b.WriteString(e.HttpStatus)
+	}
+	if len(e.Code) > 0 || len(e.RequestID) > 0 {
+		b.WriteString(" (")
+		if len(e.Code) > 0 {
+			b.WriteString(e.Code)
+			if len(e.RequestID) > 0 {
+				b.WriteString(", ")
+			}
+		}
+		if len(e.RequestID) > 0 {
+			b.WriteString("request-id ")
+			b.WriteString(e.RequestID)
+		}
+		b.WriteByte(')')
+	}
+	return b.String()
+}
+
+// Gets the HTTP Status code returned if there was an error
+func (e *MsGraphError) StatusCode() int {
+	return e.HttpStatusCode
+}
+
+// Is allows errors.Is to match an *MsGraphError against the sentinel errors of this package
+func (e *MsGraphError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.HttpStatusCode == http.StatusNotFound
+	case ErrThrottled:
+		return e.HttpStatusCode == http.StatusTooManyRequests ||
+			(e.HttpStatusCode == http.StatusServiceUnavailable && e.RetryAfter > 0) ||
+			e.hasCode("activityLimitReached", "TooManyRequests", "ApplicationThrottled")
+	case ErrAccessDenied:
+		return e.HttpStatusCode == http.StatusForbidden ||
+			e.hasCode("ErrorAccessDenied", "accessDenied", "Authorization_RequestDenied")
+	case ErrMailboxNotEnabled:
+		return e.hasCode("MailboxNotEnabledForRESTAPI", "MailboxNotHostedInExchangeOnline")
+	case ErrConflict:
+		return e.HttpStatusCode == http.StatusPreconditionFailed
+	}
+	return false
+}
+
+func (e *MsGraphError) hasCode(codes ...string) bool {
+	for _, code := range codes {
+		if strings.EqualFold(e.Code, code) {
+			return true
+		}
+		for inner := e.InnerError; inner != nil; inner = inner.InnerError {
+			if strings.EqualFold(inner.Code, code) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func IsThrottled(err error) bool {
+	return errors.Is(err, ErrThrottled)
+}
+
+func IsAccessDenied(err error) bool {
+	return errors.Is(err, ErrAccessDenied)
+}
+
+func IsMailboxNotEnabled(err error) bool {
+	return errors.Is(err, ErrMailboxNotEnabled)
+}
+
+// Reports whether a conditional update or delete failed because the item had been changed
+// since it was read (HTTP 412)
+func IsConflict(err error) bool {
+	return errors.Is(err, ErrConflict)
+}
+
+// newMsGraphError builds the error for a failed HTTP response, consuming the body
+func newMsGraphError(res *http.Response) *MsGraphError {
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	return parseMsGraphError(res.StatusCode, res.Status, res.Header.Get, body)
+}
+
+// parseMsGraphError decodes a Graph error body.  Headers are taken in preference to the
+// innerError as they are present even when the body isn't JSON.
+func parseMsGraphError(statusCode int, status string, header func(string) string, body []byte) *MsGraphError {
+	if len(status) == 0 {
+		status = strconv.Itoa(statusCode) + " " + http.StatusText(statusCode)
+	}
+	e := &MsGraphError{
+		HttpStatusCode:  statusCode,
+		HttpStatus:      status,
+		RequestID:       header("request-id"),
+		ClientRequestID: header("client-request-id"),
+		Date:            header("Date"),
+	}
+	e.RetryAfter, _ = parseRetryAfter(header("Retry-After"))
+	var mserr msGraphError
+	if err := json.Unmarshal(body, &mserr); err == nil {
+		e.Code = mserr.Error.Code
+		e.Message = mserr.Error.Message
+		e.Details = mserr.Error.Details
+		e.InnerError = mserr.Error.InnerError
+		if inner := e.InnerError; inner != nil {
+			if len(e.RequestID) == 0 {
+				e.RequestID = inner.RequestID
+			}
+			if len(e.ClientRequestID) == 0 {
+				e.ClientRequestID = inner.ClientRequestID
+			}
+			if len(e.Date) == 0 {
+				e.Date = inner.Date
+			}
+		}
+	} else if text := strings.TrimSpace(string(body)); len(text) > 0 {
+		// not JSON, e.g. an HTML page from a proxy or gateway
+		if len(text) > 512 {
+			text = text[:512] + "..."
+		}
+		e.Message = fmt.Sprintf("%s: %s", status, text)
+	}
+	return e
+}
+
+// headerLookup adapts a plain map of headers, as found in batch responses, for parseMsGraphError
+func headerLookup(headers map[string]string) func(string) string {
+	return func(name string) string {
+		for k, v := range headers {
+			if strings.EqualFold(k, name) {
+				return v
+			}
+		}
+		return ""
+	}
+}
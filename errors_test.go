@@ -0,0 +1,38 @@
+package msgraph
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func Test_parseMsGraphError(t *testing.T) {
+	headers := map[string]string{"Request-Id": "hdr-id", "Retry-After": "5"}
+	body := []byte(`{"error":{"code":"MailboxNotEnabledForRESTAPI","message":"REST API is not yet supported for this mailbox.",
+		"innerError":{"date":"2021-01-02T03:04:05","request-id":"inner-id","client-request-id":"client-id"}}}`)
+	e := parseMsGraphError(http.StatusNotFound, "", headerLookup(headers), body)
+	if e.RequestID != "hdr-id" || e.ClientRequestID != "client-id" || e.Date != "2021-01-02T03:04:05" {
+		t.Errorf("parseMsGraphError() ids = %q, %q, %q", e.RequestID, e.ClientRequestID, e.Date)
+	}
+	headers["Date"] = "Sat, 02 Jan 2021 03:04:06 GMT"
+	if e = parseMsGraphError(http.StatusNotFound, "", headerLookup(headers), body); e.Date != headers["Date"] {
+		t.Errorf("parseMsGraphError() date = %q, want the header's", e.Date)
+	}
+	if e.HttpStatus != "404 Not Found" || e.RetryAfter.Seconds() != 5 {
+		t.Errorf("parseMsGraphError() status = %q, retry after %v", e.HttpStatus, e.RetryAfter)
+	}
+	wrapped := fmt.Errorf("listing messages: %w", e)
+	if !IsNotFound(wrapped) || !IsMailboxNotEnabled(wrapped) || IsThrottled(wrapped) || IsAccessDenied(wrapped) {
+		t.Errorf("predicates failed for %v", wrapped)
+	}
+	var target *MsGraphError
+	if !errors.As(wrapped, &target) || target.Code != "MailboxNotEnabledForRESTAPI" {
+		t.Errorf("errors.As() failed for %v", wrapped)
+	}
+
+	e = parseMsGraphError(http.StatusBadGateway, "502 Bad Gateway", headerLookup(nil), []byte("<html>oops</html>"))
+	if e.Error() != "502 Bad Gateway: <html>oops</html>" {
+		t.Errorf("Error() = %q", e.Error())
+	}
+}
@@ -0,0 +1,446 @@
+package tokencache
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/oauth2"
+
+	"github.com/jjcinaz/msgraph"
+)
+
+// EncryptedCache keeps the tokens of any number of accounts, tenants and applications in one file,
+// encrypted with AES-256-GCM.  A lock file next to it serialises access by concurrent processes, and
+// it implements msgraph.TokenLocker so that only one process refreshes a token at a time.
+// Tokens are kept after their access token expires so that the refresh token can still be used.
+type EncryptedCache struct {
+	path       string
+	key        []byte // fixed key, nil when derived from passphrase
+	passphrase []byte
+	derived    []byte // key derived from passphrase for salt
+	salt       []byte
+	mu         sync.Mutex // serialises reading and writing the file within the process
+	lockMu     sync.Mutex
+	held       int
+	locking    chan struct{} // closed once the goroutine taking the file lock is done
+	lockFile   *os.File
+}
+
+// Account describes an entry of an EncryptedCache
+type Account struct {
+	Key      msgraph.CacheKey
+	Username string
+	Expiry   time.Time // of the access token
+}
+
+type cacheEntry struct {
+	TenantID string        `json:"tenant_id"`
+	ClientID string        `json:"client_id"`
+	Account  string        `json:"account"`
+	Username string        `json:"username,omitempty"`
+	Token    *oauth2.Token `json:"token"`
+	IDToken  string        `json:"id_token,omitempty"` // not kept by Token's JSON
+}
+
+// envelope is the file format: the encrypted JSON of a map of cacheEntry
+type envelope struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`            // "scrypt" or "none" for a key file
+	Salt    []byte `json:"salt,omitempty"` // for scrypt
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+const (
+	envelopeVersion = 1
+	lockPoll        = 50 * time.Millisecond
+)
+
+var additionalData = []byte("msgraph token cache v1")
+
+// Returns the default location of an encrypted cache, in the user's cache directory
+func DefaultPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "msgraph", "tokens.enc"), nil
+}
+
+// Creates a cache encrypted with a key derived from passphrase using scrypt
+func NewEncrypted(path string, passphrase string) (*EncryptedCache, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("a passphrase is required")
+	}
+	return newEncrypted(path, nil, []byte(passphrase))
+}
+
+// Creates a cache encrypted with the 32 byte key held in keyFile, e.g. one provided by the operating system's
+// secret store or a mounted secret.  If keyFile doesn't exist a random key is written to it, readable only by the user.
+func NewEncryptedWithKeyFile(path string, keyFile string) (*EncryptedCache, error) {
+	key, err := ioutil.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		key, err = createKeyFile(keyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key file %s must hold 32 bytes, not %d", keyFile, len(key))
+	}
+	return newEncrypted(path, key, nil)
+}
+
+// createKeyFile writes a random key to keyFile unless another process has just created it, in which
+// case its key is returned.  The key is written to a temporary file which is then linked into place,
+// so the key file never exists half written and only one process's key can win.
+func createKeyFile(keyFile string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(keyFile), filepath.Base(keyFile)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if err = f.Chmod(0600); err == nil {
+		_, err = f.Write(key)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Link(f.Name(), keyFile); os.IsExist(err) {
+		return ioutil.ReadFile(keyFile)
+	}
+	return key, err
+}
+
+func newEncrypted(path string, key []byte, passphrase []byte) (*EncryptedCache, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	return &EncryptedCache{path: path, key: key, passphrase: passphrase}, nil
+}
+
+// Load returns the client's token.  A client that doesn't know its account yet, as when NewClient or
+// NewDeviceCodeClient start, gets the token of the only account cached for its tenant and application;
+// with several accounts it is not found and the user signs in again.
+func (ec *EncryptedCache) Load(c *msgraph.Client) (*oauth2.Token, error) {
+	var token *oauth2.Token
+	key := c.CacheKey()
+	err := ec.read(func(entries map[string]*cacheEntry) {
+		e, ok := entries[key.String()]
+		if !ok && len(key.Account) == 0 {
+			e, ok = onlyEntry(entries, key)
+		}
+		if ok {
+			token = e.Token
+			if len(e.IDToken) > 0 {
+				token = token.WithExtra(map[string]interface{}{"id_token": e.IDToken})
+			}
+		}
+	})
+	if err == nil && token == nil {
+		err = os.ErrNotExist
+	}
+	return token, err
+}
+
+func (ec *EncryptedCache) Save(c *msgraph.Client, token *oauth2.Token) error {
+	key := c.CacheKey()
+	idToken, _ := token.Extra("id_token").(string)
+	return ec.update(func(entries map[string]*cacheEntry) {
+		entries[key.String()] = &cacheEntry{
+			TenantID: key.TenantID,
+			ClientID: key.ClientID,
+			Account:  key.Account,
+			Username: c.Account().Username,
+			Token:    token,
+			IDToken:  idToken,
+		}
+	})
+}
+
+// onlyEntry returns the entry of key's tenant and application if there is just one
+func onlyEntry(entries map[string]*cacheEntry, key msgraph.CacheKey) (*cacheEntry, bool) {
+	var found *cacheEntry
+	for _, e := range entries {
+		if e.TenantID == key.TenantID && e.ClientID == key.ClientID {
+			if found != nil {
+				return nil, false
+			}
+			found = e
+		}
+	}
+	return found, found != nil
+}
+
+// Lock implements msgraph.TokenLocker, holding the file lock while a token is refreshed
+func (ec *EncryptedCache) Lock(ctx context.Context, c *msgraph.Client) (func(), error) {
+	return ec.acquire(ctx)
+}
+
+// Lists the accounts held in the cache
+func (ec *EncryptedCache) Accounts() ([]Account, error) {
+	var accounts []Account
+	err := ec.read(func(entries map[string]*cacheEntry) {
+		for _, e := range entries {
+			a := Account{
+				Key:      msgraph.CacheKey{TenantID: e.TenantID, ClientID: e.ClientID, Account: e.Account},
+				Username: e.Username,
+			}
+			if e.Token != nil {
+				a.Expiry = e.Token.Expiry
+			}
+			accounts = append(accounts, a)
+		}
+	})
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Key.String() < accounts[j].Key.String()
+	})
+	return accounts, err
+}
+
+// Removes an account's token, e.g. to sign it out.  Removing an absent account is not an error.
+func (ec *EncryptedCache) Remove(key msgraph.CacheKey) error {
+	return ec.update(func(entries map[string]*cacheEntry) {
+		delete(entries, key.String())
+	})
+}
+
+func (ec *EncryptedCache) read(fn func(map[string]*cacheEntry)) error {
+	release, err := ec.acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer release()
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	entries, _, err := ec.load()
+	if err == nil {
+		fn(entries)
+	}
+	return err
+}
+
+func (ec *EncryptedCache) update(fn func(map[string]*cacheEntry)) error {
+	release, err := ec.acquire(context.Background())
+	if err != nil {
+		return err
+	}
+	defer release()
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	entries, salt, err := ec.load()
+	if err != nil {
+		return err
+	}
+	fn(entries)
+	return ec.store(entries, salt)
+}
+
+// load decrypts the file, returning no entries if it doesn't exist yet
+func (ec *EncryptedCache) load() (map[string]*cacheEntry, []byte, error) {
+	entries := make(map[string]*cacheEntry)
+	data, err := ioutil.ReadFile(ec.path)
+	if os.IsNotExist(err) {
+		return entries, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	var env envelope
+	if err = json.Unmarshal(data, &env); err != nil {
+		return nil, nil, fmt.Errorf("token cache %s is corrupt: %w", ec.path, err)
+	}
+	if env.Version != envelopeVersion {
+		return nil, nil, fmt.Errorf("token cache %s has unsupported version %d", ec.path, env.Version)
+	}
+	aead, err := ec.cipher(env.Salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	plain, err := aead.Open(nil, env.Nonce, env.Data, additionalData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("token cache %s cannot be decrypted, wrong key or passphrase?", ec.path)
+	}
+	if err = json.Unmarshal(plain, &entries); err != nil {
+		return nil, nil, err
+	}
+	return entries, env.Salt, nil
+}
+
+func (ec *EncryptedCache) store(entries map[string]*cacheEntry, salt []byte) error {
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	env := envelope{Version: envelopeVersion, KDF: "none"}
+	if ec.key == nil {
+		env.KDF = "scrypt"
+		if salt == nil {
+			salt = make([]byte, 16)
+			if _, err = rand.Read(salt); err != nil {
+				return err
+			}
+		}
+		env.Salt = salt
+	}
+	aead, err := ec.cipher(env.Salt)
+	if err != nil {
+		return err
+	}
+	env.Nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(env.Nonce); err != nil {
+		return err
+	}
+	env.Data = aead.Seal(nil, env.Nonce, plain, additionalData)
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(ec.path, data)
+}
+
+func (ec *EncryptedCache) cipher(salt []byte) (cipher.AEAD, error) {
+	key := ec.key
+	if key == nil {
+		if len(salt) == 0 {
+			return nil, errors.New("token cache needs a key file, not a passphrase")
+		}
+		if !bytes.Equal(salt, ec.salt) {
+			derived, err := scrypt.Key(ec.passphrase, salt, 1<<15, 8, 1, 32)
+			if err != nil {
+				return nil, err
+			}
+			ec.derived, ec.salt = derived, salt
+		}
+		key = ec.derived
+	} else if len(salt) > 0 {
+		return nil, errors.New("token cache needs a passphrase, not a key file")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// acquire takes the lock file, or shares it if another goroutine of the process already holds it.
+// One goroutine at a time waits for the file lock, without holding lockMu; the others wait for it.
+func (ec *EncryptedCache) acquire(ctx context.Context) (func(), error) {
+	var once sync.Once
+	release := func() {
+		once.Do(ec.release)
+	}
+	for {
+		ec.lockMu.Lock()
+		if ec.held > 0 {
+			ec.held++
+			ec.lockMu.Unlock()
+			return release, nil
+		}
+		locking := ec.locking
+		if locking == nil {
+			ec.locking = make(chan struct{})
+			ec.lockMu.Unlock()
+			break
+		}
+		ec.lockMu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-locking:
+		}
+	}
+	f, err := openLocked(ctx, ec.path+".lock")
+	ec.lockMu.Lock()
+	defer ec.lockMu.Unlock()
+	close(ec.locking)
+	ec.locking = nil
+	if err != nil {
+		return nil, err
+	}
+	ec.lockFile = f
+	ec.held++
+	return release, nil
+}
+
+// openLocked opens and locks path, polling while another process holds the lock
+func openLocked(ctx context.Context, path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		ok, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if ok {
+			return f, nil
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+}
+
+func (ec *EncryptedCache) release() {
+	ec.lockMu.Lock()
+	defer ec.lockMu.Unlock()
+	ec.held--
+	if ec.held == 0 {
+		unlockFile(ec.lockFile)
+		ec.lockFile.Close()
+		ec.lockFile = nil
+	}
+}
+
+// writeFileAtomic replaces a file so that readers never see it half written
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err = f.Chmod(0600); err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
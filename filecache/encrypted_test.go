@@ -0,0 +1,219 @@
+package tokencache
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/jjcinaz/msgraph"
+)
+
+func testClient(t *testing.T, oid string, username string) (*msgraph.Client, *oauth2.Token) {
+	claims := `{"oid":"` + oid + `","tid":"tenant","preferred_username":"` + username + `"}`
+	token := (&oauth2.Token{
+		AccessToken:  "at-" + oid,
+		RefreshToken: "rt-" + oid,
+		Expiry:       time.Now().Add(-time.Hour), // expired, but must be kept for its refresh token
+	}).WithExtra(map[string]interface{}{"id_token": "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"})
+	wa := msgraph.NewWebAuth("tenant", "client", "", "http://localhost/cb", nil, nil)
+	c, err := wa.ClientFromToken(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, token
+}
+
+func TestEncryptedCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens.enc")
+	ec, err := NewEncrypted(path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, aliceToken := testClient(t, "alice", "alice@acme.com")
+	bob, bobToken := testClient(t, "bob", "bob@acme.com")
+	if _, err = ec.Load(alice); !os.IsNotExist(err) {
+		t.Errorf("Load() from an empty cache error = %v", err)
+	}
+	if err = ec.Save(alice, aliceToken); err != nil {
+		t.Fatal(err)
+	}
+	if err = ec.Save(bob, bobToken); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte("rt-alice")) {
+		t.Error("refresh token stored in plain text")
+	}
+
+	// a second cache on the same file, as in another process
+	ec2, _ := NewEncrypted(path, "correct horse")
+	got, err := ec2.Load(bob)
+	if err != nil || got.RefreshToken != "rt-bob" {
+		t.Fatalf("Load() = %v, %v, want bob's expired token", got, err)
+	}
+	if got.Extra("id_token") != bobToken.Extra("id_token") {
+		t.Error("id_token not kept")
+	}
+	accounts, err := ec2.Accounts()
+	if err != nil || len(accounts) != 2 || accounts[0].Username != "alice@acme.com" {
+		t.Fatalf("Accounts() = %+v, %v", accounts, err)
+	}
+	if err = ec2.Remove(accounts[0].Key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ec.Load(alice); !os.IsNotExist(err) {
+		t.Errorf("Load() of a removed account error = %v", err)
+	}
+
+	wrong, _ := NewEncrypted(path, "battery staple")
+	if _, err = wrong.Load(bob); err == nil {
+		t.Error("Load() with the wrong passphrase succeeded")
+	}
+}
+
+func TestEncryptedCache_keyFile(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	ec, err := NewEncryptedWithKeyFile(filepath.Join(dir, "tokens.enc"), keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(keyFile); err != nil || fi.Size() != 32 {
+		t.Fatalf("key file not created: %v", err)
+	}
+	c, token := testClient(t, "carol", "carol@acme.com")
+	if err = ec.Save(c, token); err != nil {
+		t.Fatal(err)
+	}
+	ec2, _ := NewEncryptedWithKeyFile(filepath.Join(dir, "tokens.enc"), keyFile)
+	if got, err := ec2.Load(c); err != nil || got.AccessToken != "at-carol" {
+		t.Errorf("Load() = %v, %v", got, err)
+	}
+	// processes starting together on a new key file must agree on the key
+	keyFile = filepath.Join(dir, "new", "key")
+	caches := make([]*EncryptedCache, 8)
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := range caches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			caches[i], _ = NewEncryptedWithKeyFile(filepath.Join(dir, "new.enc"), keyFile)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	stored, _ := os.ReadFile(keyFile)
+	for i, ec := range caches {
+		if ec == nil || !bytes.Equal(ec.key, stored) {
+			t.Fatalf("cache %d started with a different key", i)
+		}
+	}
+}
+
+func TestEncryptedCache_Lock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.enc")
+	ec, _ := NewEncrypted(path, "pw")
+	other, _ := NewEncrypted(path, "pw")
+	c, token := testClient(t, "dave", "dave@acme.com")
+	unlock, err := ec.Lock(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the holder can still use the cache while another waits
+	if err = ec.Save(c, token); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err = other.Lock(ctx, c); err == nil {
+		t.Fatal("Lock() succeeded while held by another cache")
+	}
+
+	// a goroutine waiting for the file lock doesn't hold up others of the process giving up
+	waited := make(chan error)
+	go func() {
+		unlock, err := other.Lock(context.Background(), c)
+		if err == nil {
+			unlock()
+		}
+		waited <- err
+	}()
+	time.Sleep(2 * lockPoll)
+	start := time.Now()
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err = other.Lock(ctx, c); err == nil || time.Since(start) > time.Second {
+		t.Errorf("Lock() returned %v after %v, want the context's error", err, time.Since(start))
+	}
+	unlock()
+	if err = <-waited; err != nil {
+		t.Fatalf("Lock() after unlock error = %v", err)
+	}
+}
+
+func TestEncryptedCache_restart(t *testing.T) {
+	var prompts int
+	idToken := func(oid string) string {
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(`{"oid":"`+oid+`","tid":"tenant"}`)) + ".sig"
+	}
+	oid := "erin"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/devicecode") {
+			io.WriteString(w, `{"device_code":"dc","user_code":"ABC-123","verification_uri":"https://microsoft.com/devicelogin","expires_in":900,"interval":1}`)
+			return
+		}
+		fmt.Fprintf(w, `{"access_token":"at","refresh_token":"rt","token_type":"Bearer","expires_in":3600,"id_token":%q}`, idToken(oid))
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "tokens.enc")
+	start := func() *msgraph.Client {
+		cache, err := NewEncrypted(path, "pw") // a new process
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := msgraph.NewDeviceCodeClient(context.Background(), "tenant", "client", nil, cache,
+			func(*oauth2.DeviceAuthResponse) error {
+				prompts++
+				return nil
+			}, msgraph.WithAuthorityHost(srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	if c := start(); c.Account().ID != "erin" {
+		t.Fatalf("Account() = %+v", c.Account())
+	}
+	if c := start(); c.Account().ID != "erin" || prompts != 1 {
+		t.Errorf("restarted as %+v after %d prompts, want erin without signing in again", c.Account(), prompts)
+	}
+
+	// with a second account cached it is unclear whose token to use, so the user signs in
+	ec, _ := NewEncrypted(path, "pw")
+	frank, frankToken := testClient(t, "frank", "frank@acme.com")
+	if err := ec.Save(frank, frankToken); err != nil {
+		t.Fatal(err)
+	}
+	start()
+	if prompts != 2 {
+		t.Errorf("%d prompts, want a sign in with two accounts cached", prompts)
+	}
+}
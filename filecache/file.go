@@ -29,10 +29,12 @@ func (fc *FileCache) Load(c *msgraph.Client) (*oauth2.Token, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 	t := new(oauth2.Token)
 	err = gob.NewDecoder(f).Decode(t)
 	if err == nil {
-		if !t.Valid() {
+		// an expired token is still useful if it can be refreshed
+		if !t.Valid() && len(t.RefreshToken) == 0 {
 			_ = os.Remove(file)
 			t = nil
 			err = os.ErrNotExist
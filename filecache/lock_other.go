@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package tokencache
+
+import "os"
+
+// no file locking on this platform, only goroutines of one process are serialised
+func tryLockFile(f *os.File) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(f *os.File) {
+}
@@ -0,0 +1,19 @@
+package msgraph
+
+type Group struct {
+	Classification               string   `json:"classification,omitempty"`
+	CreatedDateTime              string   `json:"createdDateTime,omitempty"`
+	Description                  string   `json:"description,omitempty"`
+	DisplayName                  string   `json:"displayName,omitempty"`
+	GroupTypes                   []string `json:"groupTypes,omitempty"`
+	ID                           string   `json:"id"`
+	Mail                         string   `json:"mail,omitempty"`
+	MailEnabled                  bool     `json:"mailEnabled"`
+	MailNickname                 string   `json:"mailNickname,omitempty"`
+	OnPremisesLastSyncDateTime   string   `json:"onPremisesLastSyncDateTime,omitempty"`
+	OnPremisesSecurityIdentifier string   `json:"onPremisesSecurityIdentifier,omitempty"`
+	OnPremisesSyncEnabled        bool     `json:"onPremisesSyncEnabled,omitempty"`
+	ProxyAddresses               []string `json:"proxyAddresses,omitempty"`
+	SecurityEnabled              bool     `json:"securityEnabled"`
+	Visibility                   string   `json:"visibility,omitempty"`
+}
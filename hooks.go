@@ -0,0 +1,37 @@
+package msgraph
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Hooks let instrumentation, such as the otelgraph package, observe the request pipeline.
+// Together with Middleware, which sees every HTTP attempt, they allow tracing and metrics
+// without changes to the client.  All hooks are optional.
+type Hooks struct {
+	// StartCall is invoked when an API call begins.  A call covers all attempts of one request, or all
+	// pages of a listing.  The returned context is used for the call's requests and the returned
+	// function, if not nil, is invoked with the outcome when the call completes.
+	StartCall func(ctx context.Context, method string, apiUrl string) (context.Context, func(err error))
+
+	// Retry is invoked before waiting to resend a failed request.  res is nil after a network error.
+	// For a throttled sub-request of a batch, res holds only the sub-request's status.
+	Retry func(ctx context.Context, method string, attempt int, res *http.Response, err error, wait time.Duration)
+}
+
+func (c *Client) SetHooks(hooks Hooks) {
+	c.hooks = hooks
+}
+
+// startCall notifies the StartCall hook, returning a no-op completion if there isn't one
+func (c *Client) startCall(ctx context.Context, method string, apiUrl string) (context.Context, func(error)) {
+	if c.hooks.StartCall == nil {
+		return ctx, func(error) {}
+	}
+	ctx, done := c.hooks.StartCall(ctx, method, apiUrl)
+	if done == nil {
+		done = func(error) {}
+	}
+	return ctx, done
+}
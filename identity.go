@@ -0,0 +1,172 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const imdsTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// Use url in place of the managed identity token endpoint, which otherwise comes from the IDENTITY_ENDPOINT
+// environment variable or is the instance metadata service.  Requests to it are made in the IMDS style.
+func WithManagedIdentityEndpoint(url string) ClientOption {
+	return func(c *Client) {
+		c.identityURL = url
+	}
+}
+
+// Creates a new MSGraph API Client authenticating as the managed identity of the Azure VM, App Service, Function
+// or container it runs on, so no secret is needed [see https://docs.microsoft.com/en-us/azure/active-directory/managed-identities-azure-resources/overview].
+// ClientID selects a user assigned identity, leave it empty for the system assigned identity.  The App Service
+// endpoint is used when the IDENTITY_ENDPOINT and IDENTITY_HEADER environment variables are set, otherwise the
+// instance metadata service.  Graph permissions must be granted to the identity's service principal.
+func NewManagedIdentityClient(ctx context.Context, ClientID string, options ...ClientOption) (*Client, error) {
+	c := newClient(ctx, AuthTypeManagedIdentity, "", options)
+	endpoint, header := os.Getenv("IDENTITY_ENDPOINT"), os.Getenv("IDENTITY_HEADER")
+	appService := len(c.identityURL) == 0 && len(endpoint) > 0 && len(header) > 0
+	q := url.Values{"resource": {c.graphEndpoint}}
+	if appService {
+		q.Set("api-version", "2019-08-01")
+	} else {
+		endpoint = imdsTokenURL
+		if len(c.identityURL) > 0 {
+			endpoint = c.identityURL
+		}
+		q.Set("api-version", "2018-02-01")
+	}
+	if len(ClientID) > 0 {
+		q.Set("client_id", ClientID)
+	}
+	tokenURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	tokenURL.RawQuery = q.Encode()
+	c.credential = newCredential(func(ctx context.Context) (*oauth2.Token, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", tokenURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		if appService {
+			req.Header.Set("X-IDENTITY-HEADER", header)
+		} else {
+			req.Header.Set("Metadata", "true")
+		}
+		return c.managedIdentityToken(req)
+	})
+	return c, nil
+}
+
+// managedIdentityToken makes a token request, retrying while the metadata service is starting or busy
+func (c *Client) managedIdentityToken(req *http.Request) (*oauth2.Token, error) {
+	hc := http.Client{Transport: c.transport}
+	for attempt := 1; ; attempt++ {
+		res, err := hc.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("managed identity unavailable: %w", err)
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode == http.StatusOK {
+			return parseManagedIdentityToken(body)
+		}
+		retryable := res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone ||
+			res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+		if !retryable || attempt >= c.retry.MaxAttempts {
+			var e struct {
+				Error       string `json:"error"`
+				Description string `json:"error_description"`
+			}
+			if json.Unmarshal(body, &e) == nil && len(e.Error) > 0 {
+				return nil, fmt.Errorf("managed identity: %s: %s %s", res.Status, e.Error, e.Description)
+			}
+			return nil, fmt.Errorf("managed identity: %s", res.Status)
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(c.retry.backoff(attempt)):
+		}
+	}
+}
+
+func parseManagedIdentityToken(body []byte) (*oauth2.Token, error) {
+	// numbers are sent as strings by some of the endpoints
+	var reply struct {
+		AccessToken string      `json:"access_token"`
+		TokenType   string      `json:"token_type"`
+		ExpiresIn   json.Number `json:"expires_in"`
+		ExpiresOn   json.Number `json:"expires_on"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, fmt.Errorf("managed identity: %w", err)
+	}
+	if len(reply.AccessToken) == 0 {
+		return nil, errors.New("managed identity: no access token returned")
+	}
+	token := &oauth2.Token{AccessToken: reply.AccessToken, TokenType: reply.TokenType}
+	if on, err := reply.ExpiresOn.Int64(); err == nil {
+		token.Expiry = time.Unix(on, 0)
+	} else if in, err := reply.ExpiresIn.Int64(); err == nil {
+		token.Expiry = time.Now().Add(time.Duration(in) * time.Second)
+	}
+	return token, nil
+}
+
+// Creates a new MSGraph API Client using workload identity federation, as on Kubernetes with Azure AD workload
+// identity: a token issued to the workload by another identity provider, read from tokenFile, is the client
+// assertion [see https://docs.microsoft.com/en-us/azure/active-directory/develop/workload-identity-federation].
+// Empty arguments are taken from the AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_FEDERATED_TOKEN_FILE environment
+// variables, and AZURE_AUTHORITY_HOST is used unless WithCloud or WithAuthorityHost is given.
+func NewWorkloadIdentityClient(ctx context.Context, TenantID string, ClientID string, tokenFile string,
+	options ...ClientOption) (*Client, error) {
+	TenantID = stringOrEnv(TenantID, "AZURE_TENANT_ID")
+	ClientID = stringOrEnv(ClientID, "AZURE_CLIENT_ID")
+	tokenFile = stringOrEnv(tokenFile, "AZURE_FEDERATED_TOKEN_FILE")
+	if len(TenantID) == 0 || len(ClientID) == 0 || len(tokenFile) == 0 {
+		return nil, errors.New("workload identity needs a tenant ID, client ID and federated token file")
+	}
+	if host := os.Getenv("AZURE_AUTHORITY_HOST"); len(host) > 0 {
+		options = append([]ClientOption{WithAuthorityHost(strings.TrimSuffix(host, "/"))}, options...)
+	}
+	c := newClient(ctx, AuthTypeWorkloadIdentity, TenantID, options)
+	c.ccConfig.ClientID = ClientID
+	c.ccConfig.TokenURL = c.authEndpoint().TokenURL
+	c.ccConfig.Scopes = append(c.ccConfig.Scopes, c.graphScope())
+	c.ccConfig.AuthStyle = oauth2.AuthStyleInParams
+	c.credential = newCredential(func(ctx context.Context) (*oauth2.Token, error) {
+		// read every time as the file is rotated before the token in it expires
+		assertion, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg := c.ccConfig
+		cfg.EndpointParams = url.Values{
+			"client_assertion_type": {clientAssertionType},
+			"client_assertion":      {strings.TrimSpace(string(assertion))},
+		}
+		return cfg.Token(c.oauthContext(ctx))
+	})
+	return c, nil
+}
+
+func stringOrEnv(s string, env string) string {
+	if len(s) > 0 {
+		return s
+	}
+	return os.Getenv(env)
+}
@@ -0,0 +1,108 @@
+package msgraph
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// identityServer stands in for a token endpoint and Graph, answering API calls which carry want
+func identityServer(t *testing.T, want string, token http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/token") {
+			token(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer "+want {
+			t.Errorf("Authorization = %q, want Bearer %s", got, want)
+		}
+		io.WriteString(w, `{}`)
+	}))
+}
+
+func TestNewManagedIdentityClient(t *testing.T) {
+	t.Run("imds", func(t *testing.T) {
+		var calls int
+		var srv *httptest.Server
+		srv = identityServer(t, "mi", func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable) // retried
+				return
+			}
+			q := r.URL.Query()
+			if r.Header.Get("Metadata") != "true" || q.Get("resource") != srv.URL || q.Get("client_id") != "uami" {
+				t.Errorf("unexpected token request %v %v", r.Header, q)
+			}
+			fmt.Fprintf(w, `{"access_token":"mi","token_type":"Bearer","expires_in":"3599","expires_on":"%d"}`,
+				time.Now().Add(time.Hour).Unix())
+		})
+		defer srv.Close()
+		c, err := NewManagedIdentityClient(context.Background(), "uami", WithGraphEndpoint(srv.URL),
+			WithManagedIdentityEndpoint(srv.URL+"/metadata/identity/oauth2/token"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+		for i := 0; i < 2; i++ {
+			if err = c.Do(Request{Path: "/me"}, nil); err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+		}
+		if calls != 2 {
+			t.Errorf("%d token requests, want 2", calls)
+		}
+	})
+	t.Run("app service", func(t *testing.T) {
+		srv := identityServer(t, "as", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-IDENTITY-HEADER") != "secret" || r.URL.Query().Get("api-version") != "2019-08-01" {
+				t.Errorf("unexpected token request %v %v", r.Header, r.URL)
+			}
+			fmt.Fprintf(w, `{"access_token":"as","token_type":"Bearer","expires_on":"%d"}`, time.Now().Add(time.Hour).Unix())
+		})
+		defer srv.Close()
+		t.Setenv("IDENTITY_ENDPOINT", srv.URL+"/msi/token")
+		t.Setenv("IDENTITY_HEADER", "secret")
+		c, err := NewManagedIdentityClient(context.Background(), "", WithGraphEndpoint(srv.URL))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Do(Request{Path: "/me"}, nil); err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+	})
+}
+
+func TestNewWorkloadIdentityClient(t *testing.T) {
+	srv := identityServer(t, "wi", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant/oauth2/v2.0/token" || r.FormValue("client_assertion") != "federated" ||
+			r.FormValue("client_id") != "client" || r.FormValue("client_assertion_type") != clientAssertionType {
+			t.Errorf("unexpected token request %s %v", r.URL.Path, r.Form)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"wi","token_type":"Bearer","expires_in":3600}`)
+	})
+	defer srv.Close()
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("federated\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AZURE_TENANT_ID", "tenant")
+	t.Setenv("AZURE_CLIENT_ID", "client")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", file)
+	t.Setenv("AZURE_AUTHORITY_HOST", srv.URL+"/")
+	c, err := NewWorkloadIdentityClient(context.Background(), "", "", "", WithGraphEndpoint(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Do(Request{Path: "/me"}, nil); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+}
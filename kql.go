@@ -0,0 +1,191 @@
+package msgraph
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SearchQuery is a KQL mailbox search for use with OptionSearchQuery, e.g.
+//
+//	q := msgraph.SearchAnd(
+//		msgraph.SearchFrom.Has("jdoe@acme.com"),
+//		msgraph.SearchSubject.Has("quarterly report"),
+//		msgraph.SearchReceived.Between(start, end),
+//		msgraph.SearchNot(msgraph.SearchTerm("draft")),
+//	)
+//	msgs, err := c.ListMessages(upn, msgraph.OptionSearchQuery(q))
+//
+// Terms containing spaces or KQL syntax are quoted as phrases.  Mistakes such as an unknown property
+// are reported by the call using the query, before any request is sent.
+// See https://docs.microsoft.com/en-us/graph/search-query-parameter#using-search-on-message-collections
+type SearchQuery struct {
+	s   string
+	op  string // "AND", "OR" or "NOT" for a compound query, empty for a single term
+	err error
+}
+
+// SearchProperty is a message property which a search term can be restricted to
+type SearchProperty string
+
+const (
+	SearchAttachment   SearchProperty = "attachment"
+	SearchBcc          SearchProperty = "bcc"
+	SearchBody         SearchProperty = "body"
+	SearchCc           SearchProperty = "cc"
+	SearchFrom         SearchProperty = "from"
+	SearchParticipants SearchProperty = "participants"
+	SearchReceived     SearchProperty = "received"
+	SearchSent         SearchProperty = "sent"
+	SearchRecipients   SearchProperty = "recipients"
+	SearchTo           SearchProperty = "to"
+	SearchSubject      SearchProperty = "subject"
+)
+
+const kqlDate = "2006-01-02"
+
+// Searches all the default properties (from, subject and body) for text
+func SearchTerm(text string) SearchQuery {
+	term, err := kqlTerm(text)
+	return SearchQuery{s: term, err: err}
+}
+
+// Searches the property for text, e.g. SearchSubject.Has("quarterly report")
+func (p SearchProperty) Has(text string) SearchQuery {
+	if err := p.validate(); err != nil {
+		return SearchQuery{err: err}
+	}
+	term, err := kqlTerm(text)
+	return SearchQuery{s: string(p) + ":" + term, err: err}
+}
+
+// Matches messages received or sent on or after the day of t
+func (p SearchProperty) After(t time.Time) SearchQuery {
+	return p.compareDate(">=", t)
+}
+
+// Matches messages received or sent before the day of t
+func (p SearchProperty) Before(t time.Time) SearchQuery {
+	return p.compareDate("<", t)
+}
+
+// Matches messages received or sent from the day of from up to and including the day of to.
+// A zero from or to leaves that end of the range open.
+func (p SearchProperty) Between(from, to time.Time) SearchQuery {
+	switch {
+	case from.IsZero():
+		return p.compareDate("<=", to)
+	case to.IsZero():
+		return p.After(from)
+	case to.Before(from):
+		return SearchQuery{err: fmt.Errorf("search range for %s ends before it starts", p)}
+	}
+	if err := p.validateDate(); err != nil {
+		return SearchQuery{err: err}
+	}
+	return SearchQuery{s: string(p) + ":" + from.Format(kqlDate) + ".." + to.Format(kqlDate)}
+}
+
+func (p SearchProperty) compareDate(op string, t time.Time) SearchQuery {
+	if err := p.validateDate(); err != nil {
+		return SearchQuery{err: err}
+	}
+	if t.IsZero() {
+		return SearchQuery{err: fmt.Errorf("search on %s needs a date", p)}
+	}
+	return SearchQuery{s: string(p) + op + t.Format(kqlDate)}
+}
+
+func (p SearchProperty) validate() error {
+	switch p {
+	case SearchAttachment, SearchBcc, SearchBody, SearchCc, SearchFrom, SearchParticipants,
+		SearchReceived, SearchSent, SearchRecipients, SearchTo, SearchSubject:
+		return nil
+	}
+	return fmt.Errorf("unknown search property %q", string(p))
+}
+
+func (p SearchProperty) validateDate() error {
+	if p != SearchReceived && p != SearchSent {
+		return fmt.Errorf("search property %s is not a date", p)
+	}
+	return nil
+}
+
+// Matches messages matching all of the queries
+func SearchAnd(queries ...SearchQuery) SearchQuery {
+	return kqlJoin("AND", queries)
+}
+
+// Matches messages matching any of the queries
+func SearchOr(queries ...SearchQuery) SearchQuery {
+	return kqlJoin("OR", queries)
+}
+
+// Excludes messages matching the query
+func SearchNot(q SearchQuery) SearchQuery {
+	if q.err == nil && len(q.s) == 0 {
+		q.err = fmt.Errorf("empty search")
+	}
+	return SearchQuery{s: "NOT " + q.wrap("NOT"), op: "NOT", err: q.err}
+}
+
+func (q SearchQuery) String() string {
+	return q.s
+}
+
+// Err returns the first mistake found while building the query
+func (q SearchQuery) Err() error {
+	return q.err
+}
+
+func kqlJoin(op string, queries []SearchQuery) SearchQuery {
+	var nonEmpty []SearchQuery
+	for _, q := range queries {
+		if q.err != nil {
+			return SearchQuery{err: q.err}
+		}
+		if len(q.s) > 0 {
+			nonEmpty = append(nonEmpty, q)
+		}
+	}
+	switch len(nonEmpty) {
+	case 0:
+		return SearchQuery{}
+	case 1:
+		return nonEmpty[0]
+	}
+	parts := make([]string, len(nonEmpty))
+	for i, q := range nonEmpty {
+		parts[i] = q.wrap(op)
+	}
+	return SearchQuery{s: strings.Join(parts, " "+op+" "), op: op}
+}
+
+// wrap parenthesises a compound query unless it uses the same operator as its context
+func (q SearchQuery) wrap(op string) string {
+	if len(q.op) == 0 || (q.op == op && op != "NOT") {
+		return q.s
+	}
+	return "(" + q.s + ")"
+}
+
+// kqlTerm quotes text as a phrase if it contains spaces, KQL punctuation or is an operator keyword.
+// A trailing * for prefix matching is left unquoted where possible.
+func kqlTerm(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if len(text) == 0 {
+		return "", fmt.Errorf("empty search term")
+	}
+	if strings.ContainsRune(text, '"') {
+		return "", fmt.Errorf("search term %q cannot contain double quotes", text)
+	}
+	switch strings.ToUpper(text) {
+	case "AND", "OR", "NOT", "NEAR":
+		return `"` + text + `"`, nil
+	}
+	if strings.ContainsAny(text, " \t():<>=") {
+		return `"` + text + `"`, nil
+	}
+	return text, nil
+}
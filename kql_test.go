@@ -0,0 +1,44 @@
+package msgraph
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearchQuery(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2021, 1, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		query   SearchQuery
+		want    string
+		wantErr bool
+	}{
+		{"term", SearchTerm("budget"), "budget", false},
+		{"phrase", SearchSubject.Has("quarterly report"), `subject:"quarterly report"`, false},
+		{"keyword", SearchTerm("or"), `"or"`, false},
+		{"prefix", SearchFrom.Has("jdoe*"), "from:jdoe*", false},
+		{"between", SearchReceived.Between(start, end), "received:2021-01-01..2021-01-31", false},
+		{"after", SearchSent.After(start), "sent>=2021-01-01", false},
+		{"open range", SearchReceived.Between(time.Time{}, end), "received<=2021-01-31", false},
+		{"and or", SearchAnd(SearchFrom.Has("bob"), SearchOr(SearchTerm("a"), SearchTerm("b"))), "from:bob AND (a OR b)", false},
+		{"flatten", SearchAnd(SearchTerm("a"), SearchAnd(SearchTerm("b"), SearchTerm("c"))), "a AND b AND c", false},
+		{"not", SearchNot(SearchOr(SearchTerm("a"), SearchTerm("b"))), "NOT (a OR b)", false},
+		{"unknown property", SearchProperty("folder").Has("inbox"), "", true},
+		{"date property", SearchSubject.After(start), "", true},
+		{"reversed range", SearchReceived.Between(end, start), "", true},
+		{"empty term", SearchTerm(" "), "", true},
+		{"quote", SearchTerm(`say "hi"`), "", true},
+		{"error propagates", SearchAnd(SearchTerm("a"), SearchTerm("")), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.query.Err() != nil) != tt.wantErr {
+				t.Fatalf("Err() = %v, wantErr %v", tt.query.Err(), tt.wantErr)
+			}
+			if got := tt.query.String(); !tt.wantErr && got != tt.want {
+				t.Errorf("String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package msgraph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LogBodyLevel selects which HTTP bodies are captured by structured logging
+type LogBodyLevel int
+
+const (
+	LogBodyNone      LogBodyLevel = iota // no bodies
+	LogBodyErrors                        // response bodies of failed calls
+	LogBodyResponses                     // all response bodies
+	LogBodyAll                           // request and response bodies
+)
+
+const redacted = "[REDACTED]"
+
+// Values of these JSON properties are never logged
+var alwaysRedactFields = []string{"contentBytes", "access_token", "refresh_token", "id_token", "client_secret", "client_assertion"}
+
+var (
+	bearerPattern = regexp.MustCompile(`(?i)bearer\s+[a-z0-9\-._~+/]+=*`)
+	emailPattern  = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+(@|%40)[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`)
+)
+
+// LogOptions control structured API logging, see SetLogger
+type LogOptions struct {
+	Level        slog.Level   // level of records for successful calls; failures are logged at slog.LevelWarn
+	Body         LogBodyLevel // which bodies to capture
+	MaxBody      int          // number of bytes captured from each body, default 4096
+	RedactFields []string     // JSON properties whose values are replaced, in addition to contentBytes and tokens
+	RedactEmails bool         // mask email addresses in URLs and bodies
+}
+
+type apiLogger struct {
+	logger       *slog.Logger
+	opts         LogOptions
+	fields       map[string]bool
+	fieldPattern *regexp.Regexp // matches the redacted fields in bodies which aren't complete JSON
+}
+
+type contextKey int
+
+const (
+	pageKey contextKey = iota
+	attemptKey
+)
+
+// Returns the page number (1 based) of a paged listing to which a request belongs,
+// or 0 if the request isn't part of a listing.  For use by Middleware.
+func RequestPage(ctx context.Context) int {
+	n, _ := ctx.Value(pageKey).(int)
+	return n
+}
+
+// Returns the attempt number (1 based) of a request which may be retried.  For use by Middleware.
+func RequestAttempt(ctx context.Context) int {
+	n, _ := ctx.Value(attemptKey).(int)
+	return n
+}
+
+// Enable structured logging of every API request to logger.  Each request is logged once its response
+// body has been consumed with the method, URL, status, latency, Graph request-id, page number,
+// attempt number and payload sizes.  Bodies are only captured as requested by options.Body and
+// always have attachment content and tokens redacted.  Pass a nil logger to turn logging off.
+func (c *Client) SetLogger(logger *slog.Logger, options LogOptions) {
+	if logger == nil {
+		c.logger = nil
+		return
+	}
+	if options.MaxBody <= 0 {
+		options.MaxBody = 4096
+	}
+	l := &apiLogger{logger: logger, opts: options, fields: make(map[string]bool)}
+	for _, f := range alwaysRedactFields {
+		l.fields[strings.ToLower(f)] = true
+	}
+	for _, f := range options.RedactFields {
+		l.fields[strings.ToLower(f)] = true
+	}
+	l.fieldPattern = redactFieldPattern(l.fields)
+	c.logger = l
+}
+
+// Enable structured logging, see SetLogger
+func WithLogger(logger *slog.Logger, options LogOptions) ClientOption {
+	return func(c *Client) {
+		c.SetLogger(logger, options)
+	}
+}
+
+func (l *apiLogger) middleware(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		var reqBody []byte
+		if l.opts.Body >= LogBodyAll && r.GetBody != nil {
+			if rc, err := r.GetBody(); err == nil {
+				reqBody, _ = ioutil.ReadAll(io.LimitReader(rc, int64(l.opts.MaxBody)))
+				_ = rc.Close()
+			}
+		}
+		start := time.Now()
+		res, err := next.RoundTrip(r)
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("url", l.redactURL(r.URL)),
+		}
+		if page := RequestPage(r.Context()); page > 0 {
+			attrs = append(attrs, slog.Int("page", page))
+		}
+		if attempt := RequestAttempt(r.Context()); attempt > 1 {
+			attrs = append(attrs, slog.Int("attempt", attempt))
+		}
+		if r.ContentLength > 0 {
+			attrs = append(attrs, slog.Int64("request_bytes", r.ContentLength))
+		}
+		if reqBody != nil {
+			attrs = append(attrs, slog.String("request_body", l.redactBody(reqBody)))
+		}
+		if err != nil {
+			attrs = append(attrs, slog.Duration("latency", time.Since(start)), slog.String("error", err.Error()))
+			l.logger.LogAttrs(r.Context(), slog.LevelWarn, "graph request failed", attrs...)
+			return res, err
+		}
+		attrs = append(attrs, slog.Int("status", res.StatusCode))
+		if id := res.Header.Get("request-id"); len(id) > 0 {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		capture := l.opts.Body >= LogBodyResponses || (l.opts.Body >= LogBodyErrors && res.StatusCode >= 400)
+		res.Body = &loggedBody{ReadCloser: res.Body, log: l, ctx: r.Context(), start: start, attrs: attrs,
+			failed: res.StatusCode >= 400, capture: capture}
+		return res, nil
+	})
+}
+
+// loggedBody counts the response payload and emits the log record when the body is closed,
+// so the latency covers the whole transfer
+type loggedBody struct {
+	io.ReadCloser
+	log     *apiLogger
+	ctx     context.Context
+	start   time.Time
+	attrs   []slog.Attr
+	failed  bool
+	capture bool
+	n       int64
+	buf     bytes.Buffer
+	done    bool
+}
+
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if b.capture && b.buf.Len() < b.log.opts.MaxBody {
+		room := b.log.opts.MaxBody - b.buf.Len()
+		if room > n {
+			room = n
+		}
+		b.buf.Write(p[:room])
+	}
+	return n, err
+}
+
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if !b.done {
+		b.done = true
+		attrs := append(b.attrs, slog.Duration("latency", time.Since(b.start)), slog.Int64("response_bytes", b.n))
+		if b.capture {
+			attrs = append(attrs, slog.String("response_body", b.log.redactBody(b.buf.Bytes())))
+		}
+		level := b.log.opts.Level
+		if b.failed {
+			level = slog.LevelWarn
+		}
+		b.log.logger.LogAttrs(b.ctx, level, "graph request", attrs...)
+	}
+	return err
+}
+
+func (l *apiLogger) redactURL(u *url.URL) string {
+	s := u.String()
+	if unescaped, err := url.QueryUnescape(s); err == nil {
+		s = unescaped
+	}
+	if l.opts.RedactEmails {
+		s = redactEmails(s)
+	}
+	return s
+}
+
+// redactBody removes secrets and configured PII from a captured body.  Complete JSON documents
+// are redacted structurally; anything else, including JSON truncated by MaxBody, by pattern.
+func (l *apiLogger) redactBody(body []byte) string {
+	var doc interface{}
+	s := string(body)
+	if err := json.Unmarshal(body, &doc); err == nil {
+		if b, err := json.Marshal(l.redactValue(doc)); err == nil {
+			s = string(b)
+		}
+	} else {
+		s = l.fieldPattern.ReplaceAllString(s, `$1"`+redacted+`"`)
+	}
+	s = bearerPattern.ReplaceAllString(s, "Bearer "+redacted)
+	if l.opts.RedactEmails {
+		s = redactEmails(s)
+	}
+	return s
+}
+
+func (l *apiLogger) redactValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, child := range x {
+			if l.fields[strings.ToLower(k)] {
+				x[k] = redacted
+			} else {
+				x[k] = l.redactValue(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range x {
+			x[i] = l.redactValue(child)
+		}
+	}
+	return v
+}
+
+// redactFieldPattern matches a string value of any of the fields, which may be cut short by truncation
+func redactFieldPattern(fields map[string]bool) *regexp.Regexp {
+	names := make([]string, 0, len(fields))
+	for f := range fields {
+		names = append(names, regexp.QuoteMeta(f))
+	}
+	sort.Strings(names)
+	return regexp.MustCompile(`(?i)("(?:` + strings.Join(names, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+}
+
+// redactEmails keeps the domain of each address, which is rarely sensitive and useful when diagnosing
+func redactEmails(s string) string {
+	return emailPattern.ReplaceAllStringFunc(s, func(addr string) string {
+		sep := "@"
+		i := strings.Index(addr, sep)
+		if i < 0 {
+			sep = "%40"
+			i = strings.Index(addr, sep)
+		}
+		return "***" + addr[i:]
+	})
+}
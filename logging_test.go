@@ -0,0 +1,126 @@
+package msgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func Test_apiLogger_redact(t *testing.T) {
+	c := &Client{}
+	c.SetLogger(slog.Default(), LogOptions{RedactFields: []string{"subject"}, RedactEmails: true})
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"json", `{"value":[{"contentBytes":"QUJD","name":"a.txt"}],"subject":"secret"}`,
+			`{"subject":"[REDACTED]","value":[{"contentBytes":"[REDACTED]","name":"a.txt"}]}`},
+		{"truncated", `{"value":[{"name":"a.txt","contentBytes":"QUJDREVG`, `{"value":[{"name":"a.txt","contentBytes":"[REDACTED]"`},
+		{"truncated fields", `{"Subject": "a \"b\"","value":[{"contentBytes":"QUJD`, `{"Subject": "[REDACTED]","value":[{"contentBytes":"[REDACTED]"`},
+		{"email", `{"address":"jdoe@acme.com"}`, `{"address":"***@acme.com"}`},
+		{"bearer", `Authorization: Bearer eyJ0eXAi.abc-def`, `Authorization: Bearer [REDACTED]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.logger.redactBody([]byte(tt.body)); got != tt.want {
+				t.Errorf("redactBody() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	u, _ := url.Parse("https://graph.microsoft.com/v1.0/users/jdoe@acme.com/messages?$filter=from/emailAddress/address%20eq%20'bob%40acme.com'")
+	if got := c.logger.redactURL(u); strings.Contains(got, "jdoe") || strings.Contains(got, "bob") {
+		t.Errorf("redactURL() = %v", got)
+	}
+}
+
+func TestClient_SetLogger(t *testing.T) {
+	var base string
+	c, srv := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("request-id", "rid-"+r.URL.Query().Get("page"))
+		switch r.URL.Path {
+		case "/v1.0/items":
+			if r.URL.Query().Get("page") == "2" {
+				io.WriteString(w, `{"value":[{"id":"3"}]}`)
+				return
+			}
+			fmt.Fprintf(w, `{"value":[{"id":"1"},{"id":"2"}],"@odata.nextLink":"%s/v1.0/items?page=2"}`, base)
+		case "/v1.0/me/events":
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `{"id":"e1"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":{"code":"ErrorItemNotFound","message":"gone"}}`)
+		}
+	})
+	base = srv.URL
+
+	for _, level := range []LogBodyLevel{LogBodyNone, LogBodyErrors, LogBodyResponses, LogBodyAll} {
+		var buf bytes.Buffer
+		c.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)), LogOptions{Level: slog.LevelInfo, Body: level})
+		p, _ := NewPager[map[string]interface{}](c, "/items")
+		if items, err := p.Collect(); err != nil || len(items) != 3 {
+			t.Fatalf("Collect() = %v, %v", items, err)
+		}
+		var event struct{ ID string }
+		if err := c.Do(Request{Method: "POST", Path: "/me/events", Body: map[string]string{"subject": "hi"}}, &event); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Do(Request{Path: "/missing"}, nil); !IsNotFound(err) {
+			t.Fatalf("Do() error = %v", err)
+		}
+
+		var records []map[string]interface{}
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var rec map[string]interface{}
+			if err := dec.Decode(&rec); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, rec)
+		}
+		if len(records) != 4 {
+			t.Fatalf("body level %d: %d records, want 4: %v", level, len(records), records)
+		}
+		for i, want := range []struct {
+			method, path string
+			status       float64
+			page         interface{}
+			level        string
+		}{
+			{"GET", "/v1.0/items", 200, 1.0, "INFO"},
+			{"GET", "/v1.0/items?page=2", 200, 2.0, "INFO"},
+			{"POST", "/v1.0/me/events", 201, nil, "INFO"},
+			{"GET", "/v1.0/missing", 404, nil, "WARN"},
+		} {
+			rec := records[i]
+			if rec["msg"] != "graph request" || rec["method"] != want.method || rec["url"] != srv.URL+want.path ||
+				rec["status"] != want.status || rec["page"] != want.page || rec["level"] != want.level {
+				t.Errorf("body level %d: record %d = %v", level, i, rec)
+			}
+			if _, ok := rec["latency"]; !ok || rec["response_bytes"] == nil || rec["response_bytes"].(float64) == 0 {
+				t.Errorf("body level %d: record %d has no latency or response size: %v", level, i, rec)
+			}
+			_, hasResponse := rec["response_body"]
+			if wantResponse := level >= LogBodyResponses || level == LogBodyErrors && i == 3; hasResponse != wantResponse {
+				t.Errorf("body level %d: record %d response body captured %v, want %v", level, i, hasResponse, wantResponse)
+			}
+			if _, hasRequest := rec["request_body"]; hasRequest != (level == LogBodyAll && i == 2) {
+				t.Errorf("body level %d: record %d request body %v", level, i, rec["request_body"])
+			}
+		}
+		if records[0]["request_id"] != "rid-" || records[1]["request_id"] != "rid-2" ||
+			records[2]["request_bytes"] != float64(len(`{"subject":"hi"}`)) {
+			t.Errorf("body level %d: request ids or request size missing: %v", level, records)
+		}
+		if level >= LogBodyResponses && records[2]["response_body"] != `{"id":"e1"}` {
+			t.Errorf("response body %v", records[2]["response_body"])
+		}
+	}
+}
@@ -37,12 +37,14 @@ type InternetMessageHeader struct {
 type Message struct {
 	client                     *Client
 	fromHasValue               bool
+	Attachments                []Attachment            `json:"attachments,omitempty"` // only with OptionExpand("attachments")
 	BccRecipients              []Recipient             `json:"bccRecipients,omitempty"`
 	Body                       ItemBody                `json:"body"`
 	BodyPreview                string                  `json:"bodyPreview,omitempty"`
 	Categories                 []string                `json:"categories,omitempty"`
 	CcRecipients               []Recipient             `json:"ccRecipients,omitempty"`
 	ChangeKey                  string                  `json:"changeKey,omitempty"`
+	ETag                       string                  `json:"@odata.etag,omitempty"`
 	ConversationID             string                  `json:"conversationId,omitempty"`
 	ConversationIndex          string                  `json:"conversationIndex,omitempty"`
 	CreatedDateTime            string                  `json:"createdDateTime"`
@@ -70,6 +72,25 @@ type Message struct {
 	WebLink                    string                  `json:"webLink,omitempty"`
 }
 
+// MessageUpdate holds the properties to change with UpdateMessage; nil fields are left unchanged
+type MessageUpdate struct {
+	BccRecipients              *[]Recipient  `json:"bccRecipients,omitempty"`
+	Body                       *ItemBody     `json:"body,omitempty"`
+	Categories                 *[]string     `json:"categories,omitempty"`
+	CcRecipients               *[]Recipient  `json:"ccRecipients,omitempty"`
+	Flag                       *FollowUpFlag `json:"flag,omitempty"`
+	From                       *Recipient    `json:"from,omitempty"`
+	Importance                 *string       `json:"importance,omitempty"`
+	InferenceClassification    *string       `json:"inferenceClassification,omitempty"`
+	IsDeliveryReceiptRequested *bool         `json:"isDeliveryReceiptRequested,omitempty"`
+	IsRead                     *bool         `json:"isRead,omitempty"`
+	IsReadReceiptRequested     *bool         `json:"isReadReceiptRequested,omitempty"`
+	ReplyTo                    *[]Recipient  `json:"replyTo,omitempty"`
+	Sender                     *Recipient    `json:"sender,omitempty"`
+	Subject                    *string       `json:"subject,omitempty"`
+	ToRecipients               *[]Recipient  `json:"toRecipients,omitempty"`
+}
+
 type MailFolder struct {
 	ChildFolderCount              int                       `json:"childFolderCount"`
 	DisplayName                   string                    `json:"displayName"`
@@ -154,51 +175,86 @@ func (c *Client) ListMessages(upn string, options ...ApiOption) ([]Message, erro
 }
 
 func (c *Client) ListMessagesInFolder(upn string, folderId string, options ...ApiOption) ([]Message, error) {
-	var (
-		err    error
-		apiUrl string
-	)
-	url := "https://graph.microsoft.com/v1.0/users/" + url.PathEscape(upn)
+	p, err := c.ListMessagesInFolderPager(upn, folderId, options...)
+	if err != nil {
+		return nil, err
+	}
+	return p.Collect()
+}
+
+func (c *Client) ListMessagesPager(upn string, options ...ApiOption) (*Pager[Message], error) {
+	return c.ListMessagesInFolderPager(upn, "", options...)
+}
+
+func (c *Client) ListMessagesInFolderPager(upn string, folderId string, options ...ApiOption) (*Pager[Message], error) {
+	urlbase := c.graphUrl("/users/" + url.PathEscape(upn))
 	if len(folderId) == 0 {
-		url = url + "/messages"
+		urlbase = urlbase + "/messages"
 	} else {
-		url = url + "/mailFolders/" + folderId + "messages"
+		urlbase = urlbase + "/mailFolders/" + url.PathEscape(folderId) + "/messages"
+	}
+	apiUrl, err := formatOptions(urlbase, options...)
+	if err != nil {
+		return nil, err
+	}
+	return newPager[Message](c, apiUrl, options), nil
+}
+
+// Returns a message by its ID, with its client set so that methods such as Send can be used.
+// OptionSelect limits the properties returned; internetMessageHeaders is only returned when selected.
+// OptionExpand("attachments") includes the attachments, OptionTextMailBody asks for a plain text body
+// and OptionImmutableID for immutable IDs.
+func (c *Client) GetMessage(upn string, msgId string, options ...ApiOption) (*Message, error) {
+	var msg Message
+	apiUrl, err := formatOptions(c.graphUrl("/users/"+url.PathEscape(upn)+"/messages/"+url.PathEscape(msgId)), options...)
+	if err != nil {
+		return nil, err
 	}
-	if apiUrl, err = formatOptions(url, options); err != nil {
+	err = c.executeRequest("GET", apiUrl, getHeaders(options), nil, func(reader io.Reader) error {
+		return json.NewDecoder(reader).Decode(&msg)
+	})
+	if err != nil {
 		return nil, err
 	}
-	max, count := getMaxItemOption(options), 0
-	msgs := make([]Message, 0, 1024)
-	headers := make(map[string]string)
-	if getTextMailBody(options) {
-		headers["Prefer"] = `outlook.body-content-type="text"`
+	msg.client = c
+	msg.fromHasValue = len(msg.From.EmailAddress.Address) > 0
+	return &msg, nil
+}
+
+// Delete a message.  Pass m.IfMatch() as an option to only delete the message if it hasn't been
+// changed since it was read.
+func (c *Client) DeleteMessage(upn, msgid string, options ...ApiOption) error {
+	return c.executeDelete(c.graphUrl("/users/"+url.PathEscape(upn)+"/messages/"+url.PathEscape(msgid)), getHeaders(options))
+}
+
+// Returns an option making an update or delete conditional on the message being unchanged since it was read
+func (m Message) IfMatch() ApiOption {
+	return optionIfMatchItem(m.ETag, m.ChangeKey)
+}
+
+// Update properties of a message, returning the updated message.  Only the non-nil fields of
+// update are changed; the recipients, body, from and sender can only be changed on a draft.
+// Pass m.IfMatch() as an option to fail with ErrConflict if the message was changed since it was read.
+func (c *Client) UpdateMessage(upn string, msgId string, update MessageUpdate, options ...ApiOption) (*Message, error) {
+	var msg Message
+	apiUrl, err := formatOptions(c.graphUrl("/users/"+url.PathEscape(upn)+"/messages/"+url.PathEscape(msgId)), options...)
+	if err != nil {
+		return nil, err
 	}
-	err2 := c.executeGetList(apiUrl, headers, func(body io.Reader) string {
-		var (
-			reply struct {
-				Context  string    `json:"@odata.context"`
-				Nextlink string    `json:"@odata.nextLink"`
-				Data     []Message `json:"value"`
-			}
-		)
-		if err = json.NewDecoder(body).Decode(&reply); err == nil {
-			msgs = append(msgs, reply.Data...)
-			count += len(reply.Data)
-			if count >= max {
-				return ""
-			}
-			return reply.Nextlink
-		}
-		return ""
+	err = c.executePatch(apiUrl, getHeaders(options), update, func(reader io.Reader) error {
+		return json.NewDecoder(reader).Decode(&msg)
 	})
-	if err == nil {
-		err = err2
+	if err != nil {
+		return nil, err
 	}
-	return msgs, err
+	msg.client = c
+	return &msg, nil
 }
 
-func (c *Client) DeleteMessage(upn, msgid string) error {
-	return c.executeDelete("https://graph.microsoft.com/v1.0/users/" + url.PathEscape(upn) + "/messages/" + url.PathEscape(msgid))
+// Marks a message as read or unread
+func (c *Client) MarkMessageRead(upn string, msgId string, read bool) error {
+	_, err := c.UpdateMessage(upn, msgId, MessageUpdate{IsRead: Bool(read)})
+	return err
 }
 
 func (m Message) Send(upn string, saveToSentItems bool) error {
@@ -214,9 +270,10 @@ func (m Message) Send(upn string, saveToSentItems bool) error {
 	if !m.fromHasValue {
 		m.From = m.Sender
 	}
+	m.ETag = "" // read only, sendMail rejects it
 	data.Msg = m
 	data.SaveToSentItems = saveToSentItems
-	return m.client.executePost("https://graph.microsoft.com/v1.0/users/"+url.PathEscape(upn)+"/sendMail",
+	return m.client.executePost(m.client.graphUrl("/users/"+url.PathEscape(upn)+"/sendMail"),
 		data, nil)
 }
 
@@ -7,41 +7,20 @@ import (
 )
 
 func (c *Client) ListMessageRules(upn string, options ...ApiOption) ([]MessageRule, error) {
-	var (
-		err    error
-		apiUrl string
-	)
-
-	apiUrl, err = formatOptions("https://graph.microsoft.com/v1.0/users/"+url.PathEscape(upn)+"/mailFolders/inbox/messagerules",
-		options)
+	p, err := c.ListMessageRulesPager(upn, options...)
 	if err != nil {
 		return nil, err
 	}
-	max, count := getMaxItemOption(options), 0
-	rules := make([]MessageRule, 0, 256)
-	headers := make(map[string]string)
-	err2 := c.executeGetList(apiUrl, headers, func(body io.Reader) string {
-		var (
-			reply struct {
-				Context  string        `json:"@odata.context"`
-				Nextlink string        `json:"@odata.nextLink"`
-				Data     []MessageRule `json:"value"`
-			}
-		)
-		if err = json.NewDecoder(body).Decode(&reply); err == nil {
-			rules = append(rules, reply.Data...)
-			count += len(reply.Data)
-			if count >= max {
-				return ""
-			}
-			return reply.Nextlink
-		}
-		return ""
-	})
-	if err == nil {
-		err = err2
+	return p.Collect()
+}
+
+func (c *Client) ListMessageRulesPager(upn string, options ...ApiOption) (*Pager[MessageRule], error) {
+	apiUrl, err := formatOptions(c.graphUrl("/users/"+url.PathEscape(upn)+"/mailFolders/inbox/messagerules"),
+		options...)
+	if err != nil {
+		return nil, err
 	}
-	return rules, err
+	return newPager[MessageRule](c, apiUrl, options), nil
 }
 
 func (c *Client) GetMessageRule(upn string, ruleId string) (*MessageRule, error) {
@@ -49,7 +28,7 @@ func (c *Client) GetMessageRule(upn string, ruleId string) (*MessageRule, error)
 		err  error
 		rule MessageRule
 	)
-	apiUrl := "https://graph.microsoft.com/v1.0/users/" + url.PathEscape(upn) + "/mailFolders/inbox/messagerules/" + ruleId
+	apiUrl := c.graphUrl("/users/" + url.PathEscape(upn) + "/mailFolders/inbox/messagerules/" + ruleId)
 	err = c.executeGet(apiUrl, func(reader io.Reader) error {
 		return json.NewDecoder(reader).Decode(&rule)
 	})
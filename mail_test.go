@@ -0,0 +1,69 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetMessage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/token") {
+			io.WriteString(w, `{"access_token":"abc","token_type":"Bearer","expires_in":3600}`)
+			return
+		}
+		if r.URL.Path != "/v1.0/users/bob@acme.com/messages/AAMk/1=" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("$select") != "subject,from,internetMessageHeaders" || q.Get("$expand") != "attachments" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		if p := r.Header.Get("Prefer"); p != `outlook.body-content-type="text", IdType="ImmutableId"` {
+			t.Errorf("unexpected Prefer header %s", p)
+		}
+		io.WriteString(w, `{"id":"AAMk/1=","subject":"hi","from":{"emailAddress":{"address":"jdoe@acme.com"}},
+			"internetMessageHeaders":[{"name":"X-Test","value":"1"}],
+			"attachments":[{"@odata.type":"#microsoft.graph.fileAttachment","name":"a.txt","contentBytes":"aGk="}]}`)
+	}))
+	defer srv.Close()
+
+	c, err := NewKeyClient(context.Background(), "tenant", "client", "secret",
+		WithAuthorityHost(srv.URL), WithGraphEndpoint(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := c.GetMessage("bob@acme.com", "AAMk/1=", OptionSelect("subject"), OptionSelect("from"),
+		OptionSelect("internetMessageHeaders"), OptionExpand("attachments"), OptionTextMailBody(), OptionImmutableID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.client != c || !msg.fromHasValue || msg.Subject != "hi" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if len(msg.InternetMessageHeaders) != 1 || len(msg.Attachments) != 1 || msg.Attachments[0].String() != "hi" {
+		t.Errorf("headers or attachments missing: %+v", msg)
+	}
+}
+
+func TestMessage_Send(t *testing.T) {
+	var payload map[string]map[string]interface{}
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&payload)
+		w.WriteHeader(http.StatusAccepted)
+	})
+	m := c.NewMessage()
+	m.ETag = `W/"CQAAABYAAAB"`
+	m.SetSubject("hi").SetSender("Bob", "bob@acme.com").AddToRecipient("Jane", "jdoe@acme.com")
+	if err := m.Send("", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := payload["message"]["@odata.etag"]; ok || payload["message"]["subject"] != "hi" {
+		t.Errorf("unexpected sendMail payload %v", payload)
+	}
+}
@@ -0,0 +1,98 @@
+package msgraph
+
+import (
+	"context"
+	"net/http"
+
+	"golang.org/x/oauth2"
+)
+
+// Middleware intercepts the HTTP requests made by the client.  It receives the next
+// RoundTripper in the chain and returns one wrapping it; a middleware may change the request,
+// inspect or replace the response, or answer without calling next at all (e.g. a test double).
+//
+// Middleware runs outside the authentication layer, so requests it sees don't carry the bearer
+// token yet.  Each attempt made by the client's RetryPolicy passes through the chain separately.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts an ordinary function to http.RoundTripper
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// Use transport for all HTTP traffic, both API calls and token requests.  This is the place
+// for proxies, custom TLS roots or connection pool limits, e.g. a configured *http.Transport.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// Add middleware to the client, see Use
+func WithMiddleware(middleware ...Middleware) ClientOption {
+	return func(c *Client) {
+		c.Use(middleware...)
+	}
+}
+
+// Sets the transport for all HTTP traffic, both API calls and token requests.
+// A nil transport restores http.DefaultTransport.
+func (c *Client) SetTransport(transport http.RoundTripper) {
+	c.transport = transport
+}
+
+// Appends middleware to the chain applied to API calls.  The first middleware added
+// is the outermost, seeing each request first and each response last.
+func (c *Client) Use(middleware ...Middleware) {
+	chain := make([]Middleware, 0, len(c.middleware)+len(middleware))
+	chain = append(chain, c.middleware...)
+	c.middleware = append(chain, middleware...)
+}
+
+// HeaderMiddleware adds fixed headers to every request, unless the request already has them
+func HeaderMiddleware(headers map[string]string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			r = r.Clone(r.Context())
+			for k, v := range headers {
+				if len(r.Header.Get(k)) == 0 {
+					r.Header.Set(k, v)
+				}
+			}
+			return next.RoundTrip(r)
+		})
+	}
+}
+
+// oauthContext carries the client's transport to the oauth2 package, which uses it
+// for token requests and beneath its authenticating transport
+func (c *Client) oauthContext(ctx context.Context) context.Context {
+	if c.transport == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: c.transport})
+}
+
+// withMiddleware wraps an authenticated HTTP client's transport in the middleware chain.
+// Structured logging, when enabled, comes last so it records the requests as changed by other
+// middleware.  Like all middleware it runs outside the oauth2 transport, so it never sees the
+// Authorization header or the token requests.
+func (c *Client) withMiddleware(hc *http.Client) *http.Client {
+	chain := c.middleware
+	if c.logger != nil {
+		chain = append(chain[:len(chain):len(chain)], c.logger.middleware)
+	}
+	if len(chain) == 0 {
+		return hc
+	}
+	rt := hc.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		rt = chain[i](rt)
+	}
+	return &http.Client{Transport: rt, Timeout: hc.Timeout, CheckRedirect: hc.CheckRedirect, Jar: hc.Jar}
+}
@@ -0,0 +1,60 @@
+package msgraph
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestClient_middleware(t *testing.T) {
+	var got http.Header
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.Write([]byte(`{}`))
+	})
+	var (
+		mu    sync.Mutex
+		trace []string
+		seen  []string // paths reaching the transport
+	)
+	record := func(s string) {
+		mu.Lock()
+		trace = append(trace, s)
+		mu.Unlock()
+	}
+	tracer := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				record(name + " in")
+				if len(r.Header.Get("Authorization")) > 0 {
+					t.Errorf("middleware %s saw the bearer token", name)
+				}
+				res, err := next.RoundTrip(r)
+				record(name + " out")
+				return res, err
+			})
+		}
+	}
+	c.SetTransport(RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		mu.Lock()
+		seen = append(seen, r.URL.Path)
+		mu.Unlock()
+		return http.DefaultTransport.RoundTrip(r)
+	}))
+	WithMiddleware(tracer("a"), HeaderMiddleware(map[string]string{"X-App": "test", "Prefer": "overridden"}))(c)
+	c.Use(tracer("b"))
+
+	if err := c.Do(Request{Path: "/me", Headers: map[string]string{"Prefer": "mine"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(trace, ",") != "a in,b in,b out,a out" {
+		t.Errorf("middleware ran in order %v", trace)
+	}
+	if got.Get("X-App") != "test" || got.Get("Prefer") != "mine" || got.Get("Authorization") != "Bearer abc" {
+		t.Errorf("unexpected request headers %v", got)
+	}
+	if len(seen) != 2 || seen[0] != "/tenant/oauth2/v2.0/token" || seen[1] != "/v1.0/me" {
+		t.Errorf("transport saw %v, want the token request and the API call", seen)
+	}
+}
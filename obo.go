@@ -0,0 +1,158 @@
+package msgraph
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const jwtBearerGrant = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// OnBehalfOf lets a middle-tier API call Graph as the user of an access token it received, using the
+// On-Behalf-Of flow [see https://docs.microsoft.com/en-us/azure/active-directory/develop/v2-oauth2-on-behalf-of-flow].
+// The incoming token must have been issued for this application's API.  Graph tokens are cached per incoming
+// token and requested again when they expire; entries are dropped once both have expired.
+type OnBehalfOf struct {
+	tenantID   string
+	clientID   string
+	clientAuth func(tokenURL string) (url.Values, error)
+	options    []ClientOption
+	mu         sync.Mutex
+	users      map[string]*oboUser // keyed by a hash of the incoming token
+}
+
+type oboUser struct {
+	graphExpiry int64 // of the Graph token in Unix nanoseconds, read by prune without locking cr
+	cr          *credential
+	expires     time.Time // of the incoming token
+}
+
+// Creates an OnBehalfOf for an application authenticating with a client secret
+func NewOnBehalfOf(TenantID string, ClientID string, ClientSecret string, options ...ClientOption) *OnBehalfOf {
+	return newOnBehalfOf(TenantID, ClientID, func(string) (url.Values, error) {
+		return url.Values{"client_secret": {ClientSecret}}, nil
+	}, options)
+}
+
+// Creates an OnBehalfOf for an application authenticating with a certificate, see NewCertificateClient
+func NewOnBehalfOfCertificate(TenantID string, ClientID string, cert *x509.Certificate, key crypto.Signer,
+	options ...ClientOption) (*OnBehalfOf, error) {
+	if cert == nil || key == nil {
+		return nil, errors.New("a certificate and private key are required")
+	}
+	if _, err := assertionAlgorithm(key); err != nil {
+		return nil, err
+	}
+	return newOnBehalfOf(TenantID, ClientID, func(tokenURL string) (url.Values, error) {
+		return certificateParams(cert, key, ClientID, tokenURL)
+	}, options), nil
+}
+
+func newOnBehalfOf(tenantID string, clientID string, clientAuth func(string) (url.Values, error), options []ClientOption) *OnBehalfOf {
+	return &OnBehalfOf{
+		tenantID:   tenantID,
+		clientID:   clientID,
+		clientAuth: clientAuth,
+		options:    options,
+		users:      make(map[string]*oboUser),
+	}
+}
+
+// Returns a Client acting as the user of userToken, the bearer token from the incoming request's
+// Authorization header.  No request is made until the client is used.
+func (o *OnBehalfOf) Client(ctx context.Context, userToken string) (*Client, error) {
+	userToken = strings.TrimSpace(strings.TrimPrefix(userToken, "Bearer "))
+	if len(userToken) == 0 {
+		return nil, errors.New("no user token")
+	}
+	c := newClient(ctx, AuthTypeOnBehalfOf, o.tenantID, o.options)
+	c.ccConfig.ClientID = o.clientID
+	c.ccConfig.TokenURL = c.authEndpoint().TokenURL
+	c.ccConfig.Scopes = append(c.ccConfig.Scopes, c.graphScope())
+	c.ccConfig.AuthStyle = oauth2.AuthStyleInParams
+	c.credential = o.user(c.ccConfig, c.oauthContext, userToken)
+	return c, nil
+}
+
+func (o *OnBehalfOf) user(cfg clientcredentials.Config, oauthContext func(context.Context) context.Context, userToken string) *credential {
+	sum := sha256.Sum256([]byte(userToken))
+	key := hex.EncodeToString(sum[:])
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.prune()
+	if u, ok := o.users[key]; ok {
+		return u.cr
+	}
+	u := &oboUser{expires: tokenExpiry(userToken)}
+	u.cr = newCredential(func(ctx context.Context) (*oauth2.Token, error) {
+		// called with u.cr locked
+		params, err := o.clientAuth(cfg.TokenURL)
+		if err != nil {
+			return nil, err
+		}
+		// clientcredentials lets grant_type be replaced, giving the jwt-bearer grant, or once the
+		// incoming token has expired a refresh if offline_access was granted
+		if prev := u.cr.token; prev != nil && len(prev.RefreshToken) > 0 && time.Now().After(u.expires) {
+			params.Set("grant_type", "refresh_token")
+			params.Set("refresh_token", prev.RefreshToken)
+		} else {
+			params.Set("grant_type", jwtBearerGrant)
+			params.Set("requested_token_use", "on_behalf_of")
+			params.Set("assertion", userToken)
+		}
+		tc := cfg
+		tc.EndpointParams = params
+		token, err := tc.Token(oauthContext(ctx))
+		if err == nil {
+			expiry := int64(math.MaxInt64)
+			if !token.Expiry.IsZero() {
+				expiry = token.Expiry.UnixNano()
+			}
+			atomic.StoreInt64(&u.graphExpiry, expiry)
+		}
+		return token, err
+	})
+	o.users[key] = u
+	return u.cr
+}
+
+// prune drops users whose incoming and Graph tokens have both expired.  It doesn't wait for a user's
+// credential, which stays locked while a token is requested.
+func (o *OnBehalfOf) prune() {
+	now := time.Now()
+	for key, u := range o.users {
+		if now.After(u.expires) && now.UnixNano() >= atomic.LoadInt64(&u.graphExpiry) {
+			delete(o.users, key)
+		}
+	}
+}
+
+// tokenExpiry reads the exp claim of a JWT without verifying it, defaulting to an hour from now
+func tokenExpiry(jwt string) time.Time {
+	parts := strings.Split(jwt, ".")
+	if len(parts) == 3 {
+		var claims struct {
+			Exp int64 `json:"exp"`
+		}
+		if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err == nil {
+			if json.Unmarshal(payload, &claims) == nil && claims.Exp > 0 {
+				return time.Unix(claims.Exp, 0)
+			}
+		}
+	}
+	return time.Now().Add(time.Hour)
+}
@@ -0,0 +1,89 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnBehalfOf(t *testing.T) {
+	exchanges := map[string]int{}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/token") {
+			if r.FormValue("grant_type") != jwtBearerGrant || r.FormValue("requested_token_use") != "on_behalf_of" ||
+				r.FormValue("client_secret") != "secret" || r.FormValue("scope") != srv.URL+"/.default" {
+				t.Errorf("unexpected token request %v", r.Form)
+			}
+			assertion := r.FormValue("assertion")
+			exchanges[assertion]++
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"graph-%s","token_type":"Bearer","expires_in":3600}`, assertion)
+			return
+		}
+		io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+
+	user := func(name string) string {
+		claims := fmt.Sprintf(`{"exp":%d}`, time.Now().Add(time.Hour).Unix())
+		return "e30." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + "." + name
+	}
+	o := NewOnBehalfOf("tenant", "client", "secret", WithAuthorityHost(srv.URL), WithGraphEndpoint(srv.URL))
+	alice, bob := user("alice"), user("bob")
+	for _, token := range []string{alice, bob, "Bearer " + alice} {
+		c, err := o.Client(context.Background(), token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = c.Do(Request{Path: "/me"}, nil); err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+	}
+	if exchanges[alice] != 1 || exchanges[bob] != 1 {
+		t.Errorf("exchanges = %v, want one per user", exchanges)
+	}
+	if len(o.users) != 2 {
+		t.Errorf("%d users cached, want 2", len(o.users))
+	}
+}
+
+func TestOnBehalfOf_pruneDuringExchange(t *testing.T) {
+	requested, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/token") && r.FormValue("assertion") == "expired" {
+			close(requested)
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"graph","token_type":"Bearer","expires_in":3600}`)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	o := NewOnBehalfOf("tenant", "client", "secret", WithAuthorityHost(srv.URL), WithGraphEndpoint(srv.URL))
+	c, _ := o.Client(context.Background(), "expired") // not a JWT, so assumed valid for an hour
+	for _, u := range o.users {
+		u.expires = time.Now().Add(-time.Minute)
+	}
+	go c.Do(Request{Path: "/me"}, nil)
+	<-requested
+
+	// the exchange in progress must not hold up pruning when another user arrives
+	done := make(chan struct{})
+	go func() {
+		o.Client(context.Background(), "other")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Client() blocked on another user's token exchange")
+	}
+}
@@ -0,0 +1,185 @@
+package msgraph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expr is an OData boolean expression for use with OptionFilterExpr.  Expressions are built from
+// Field references, which take care of literal formatting and quote escaping:
+//
+//	f := msgraph.And(
+//		msgraph.Field("from/emailAddress/address").Eq("o'brien@acme.com"),
+//		msgraph.Field("receivedDateTime").Ge(time.Now().AddDate(0, 0, -7)),
+//		msgraph.Field("toRecipients").Any(func(r msgraph.FieldRef) msgraph.Expr {
+//			return r.Field("emailAddress/address").EndsWith("@acme.com")
+//		}),
+//	)
+//	msgs, err := c.ListMessages(upn, msgraph.OptionFilterExpr(f))
+//
+// See https://docs.microsoft.com/en-us/graph/query-parameters#filter-parameter
+type Expr struct {
+	s    string
+	prec int // binding strength, used to decide on parentheses
+}
+
+const (
+	precOr = iota + 1
+	precAnd
+	precNot
+	precPrimary
+)
+
+// FieldRef refers to a property, or a path to a nested property such as "from/emailAddress/address"
+type FieldRef struct {
+	path  string
+	depth int // number of enclosing any/all lambdas
+}
+
+// LiteralValue is written into an expression unchanged, e.g. for enumeration members
+// such as LiteralValue("microsoft.graph.importance'high'")
+type LiteralValue string
+
+func Field(path string) FieldRef {
+	return FieldRef{path: path}
+}
+
+// Raw wraps an expression which has already been written and escaped
+func Raw(expr string) Expr {
+	return Expr{s: expr, prec: precOr}
+}
+
+func (e Expr) String() string {
+	return e.s
+}
+
+// Field refers to a property nested under this one, typically the variable of an any/all lambda
+func (f FieldRef) Field(path string) FieldRef {
+	return FieldRef{path: f.path + "/" + path, depth: f.depth}
+}
+
+func (f FieldRef) String() string {
+	return f.path
+}
+
+func (f FieldRef) Eq(value interface{}) Expr { return f.compare("eq", value) }
+func (f FieldRef) Ne(value interface{}) Expr { return f.compare("ne", value) }
+func (f FieldRef) Gt(value interface{}) Expr { return f.compare("gt", value) }
+func (f FieldRef) Ge(value interface{}) Expr { return f.compare("ge", value) }
+func (f FieldRef) Lt(value interface{}) Expr { return f.compare("lt", value) }
+func (f FieldRef) Le(value interface{}) Expr { return f.compare("le", value) }
+
+func (f FieldRef) StartsWith(value string) Expr { return f.function("startswith", value) }
+func (f FieldRef) EndsWith(value string) Expr   { return f.function("endswith", value) }
+func (f FieldRef) Contains(value string) Expr   { return f.function("contains", value) }
+
+// In matches any of the values, e.g. Field("department").In("Sales", "Marketing")
+func (f FieldRef) In(values ...interface{}) Expr {
+	list := make([]string, len(values))
+	for i, v := range values {
+		list[i] = Literal(v)
+	}
+	return Expr{s: f.path + " in (" + strings.Join(list, ",") + ")", prec: precPrimary}
+}
+
+// Any is true if the predicate holds for at least one member of a collection.  The predicate receives
+// a reference to the lambda variable, e.g. Field("emailAddresses").Any(func(a FieldRef) Expr { return a.Eq("x@acme.com") })
+func (f FieldRef) Any(predicate func(FieldRef) Expr) Expr {
+	return f.lambda("any", predicate)
+}
+
+// All is true if the predicate holds for every member of a collection
+func (f FieldRef) All(predicate func(FieldRef) Expr) Expr {
+	return f.lambda("all", predicate)
+}
+
+func (f FieldRef) compare(op string, value interface{}) Expr {
+	return Expr{s: f.path + " " + op + " " + Literal(value), prec: precPrimary}
+}
+
+func (f FieldRef) function(name string, value string) Expr {
+	return Expr{s: name + "(" + f.path + "," + Literal(value) + ")", prec: precPrimary}
+}
+
+func (f FieldRef) lambda(op string, predicate func(FieldRef) Expr) Expr {
+	// nested lambdas need distinct variable names: a, b, c...
+	v := string(rune('a' + f.depth%26))
+	if f.depth >= 26 {
+		v += strconv.Itoa(f.depth / 26)
+	}
+	body := predicate(FieldRef{path: v, depth: f.depth + 1})
+	return Expr{s: f.path + "/" + op + "(" + v + ":" + body.s + ")", prec: precPrimary}
+}
+
+func And(exprs ...Expr) Expr {
+	return join("and", precAnd, exprs)
+}
+
+func Or(exprs ...Expr) Expr {
+	return join("or", precOr, exprs)
+}
+
+func Not(e Expr) Expr {
+	return Expr{s: "not " + e.wrap(precNot), prec: precNot}
+}
+
+func join(op string, prec int, exprs []Expr) Expr {
+	var nonEmpty []Expr
+	for _, e := range exprs {
+		if len(e.s) > 0 {
+			nonEmpty = append(nonEmpty, e)
+		}
+	}
+	switch len(nonEmpty) {
+	case 0:
+		return Expr{}
+	case 1:
+		return nonEmpty[0]
+	}
+	parts := make([]string, len(nonEmpty))
+	for i, e := range nonEmpty {
+		parts[i] = e.wrap(prec)
+	}
+	return Expr{s: strings.Join(parts, " "+op+" "), prec: prec}
+}
+
+// wrap parenthesises the expression if it binds less tightly than its context
+func (e Expr) wrap(prec int) string {
+	if e.prec < prec || (prec == precNot && e.prec != precPrimary) {
+		return "(" + e.s + ")"
+	}
+	return e.s
+}
+
+// Literal formats a Go value as an OData literal: strings are quoted with embedded quotes
+// doubled, times are written in UTC as unquoted ISO 8601 and nil is null.
+func Literal(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case LiteralValue:
+		return string(v)
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return "null"
+		}
+		return v.UTC().Format(time.RFC3339)
+	case bool:
+		return strconv.FormatBool(v)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%d", v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case fmt.Stringer:
+		return Literal(v.String())
+	}
+	return Literal(fmt.Sprint(value))
+}
@@ -0,0 +1,42 @@
+package msgraph
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpr(t *testing.T) {
+	when := time.Date(2021, 3, 4, 5, 6, 7, 0, time.FixedZone("MST", -7*3600))
+	tests := []struct {
+		name string
+		expr Expr
+		want string
+	}{
+		{"eq string", Field("from/emailAddress/address").Eq("o'brien@acme.com"), "from/emailAddress/address eq 'o''brien@acme.com'"},
+		{"ge time", Field("receivedDateTime").Ge(when), "receivedDateTime ge 2021-03-04T12:06:07Z"},
+		{"ne bool", Field("isRead").Ne(true), "isRead ne true"},
+		{"eq null", Field("manager").Eq(nil), "manager eq null"},
+		{"lt number", Field("size").Lt(1024), "size lt 1024"},
+		{"enum", Field("importance").Eq(LiteralValue("'high'")), "importance eq 'high'"},
+		{"in", Field("department").In("Sales", "R&D"), "department in ('Sales','R&D')"},
+		{"startswith", Field("subject").StartsWith("Re: it's"), "startswith(subject,'Re: it''s')"},
+		{"and or", And(Field("a").Eq(1), Or(Field("b").Eq(2), Field("c").Eq(3))), "a eq 1 and (b eq 2 or c eq 3)"},
+		{"or and", Or(And(Field("a").Eq(1), Field("b").Eq(2)), Field("c").Eq(3)), "a eq 1 and b eq 2 or c eq 3"},
+		{"not", Not(Or(Field("a").Eq(1), Field("b").Eq(2))), "not (a eq 1 or b eq 2)"},
+		{"and raw", And(Raw("a eq 1 or b eq 2"), Field("c").Eq(3)), "(a eq 1 or b eq 2) and c eq 3"},
+		{"single", And(Field("a").Eq(1)), "a eq 1"},
+		{"any", Field("toRecipients").Any(func(r FieldRef) Expr {
+			return r.Field("emailAddress/address").EndsWith("@acme.com")
+		}), "toRecipients/any(a:endswith(a/emailAddress/address,'@acme.com'))"},
+		{"nested", Field("groups").All(func(g FieldRef) Expr {
+			return g.Field("members").Any(func(m FieldRef) Expr { return m.Eq("x") })
+		}), "groups/all(a:a/members/any(b:b eq 'x'))"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.expr.String(); got != tt.want {
+				t.Errorf("String() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -21,6 +21,9 @@ type optSearch struct {
 	value string
 	prop  string // "attachment", "bcc", "body", "cc", "from", "participants", "received", "sent", "recipients", "to", "subject"
 }
+type optSearchQuery struct {
+	query SearchQuery
+}
 type optSelect struct {
 	field string
 }
@@ -32,6 +35,25 @@ type optPageSize struct {
 	n int
 }
 
+type optOrderBy struct {
+	field string
+	desc  bool
+}
+
+type optExpand struct {
+	expand string
+}
+
+type optSkip struct {
+	n int
+}
+
+type optCount struct {
+}
+
+type optEventual struct {
+}
+
 type optMax struct {
 	n int
 }
@@ -39,6 +61,13 @@ type optMax struct {
 type optTextMailBody struct {
 }
 
+type optImmutableID struct {
+}
+
+type optIfMatch struct {
+	etag string
+}
+
 type optStartDateTime struct {
 	when time.Time
 }
@@ -73,26 +102,103 @@ func OptionEndDateTime(i interface{}) ApiOption {
 	return optEndDateTime{when: t}
 }
 
+// Sets the number of items per page ($top).  For most collections Graph returns further pages
+// up to its limit, use OptionMaxItems to stop after a number of items.
 func OptionPageSize(n int) ApiOption {
 	return optPageSize{n: n}
 }
 
+// Same as OptionPageSize
+func OptionTop(n int) ApiOption {
+	return optPageSize{n: n}
+}
+
+func OptionSkip(n int) ApiOption {
+	return optSkip{n: n}
+}
+
+// Sorts by field in ascending order.  Repeat the option to sort by several fields.
+func OptionOrderBy(field string) ApiOption {
+	return optOrderBy{field: field}
+}
+
+func OptionOrderByDesc(field string) ApiOption {
+	return optOrderBy{field: field, desc: true}
+}
+
+// Expands a navigation property, e.g. OptionExpand("attachments") or
+// OptionExpand("members($select=id,displayName)").  Repeat the option to expand several.
+func OptionExpand(expand string) ApiOption {
+	return optExpand{expand: expand}
+}
+
+// Asks for the total number of items ($count), see Pager.TotalCount.  This is an advanced
+// directory query so it also sends the ConsistencyLevel: eventual header.
+func OptionCount() ApiOption {
+	return optCount{}
+}
+
+// Sends the ConsistencyLevel: eventual header which directory objects require for advanced
+// queries, e.g. filters using endsWith or ne, without asking for a count
+func OptionConsistencyEventual() ApiOption {
+	return optEventual{}
+}
+
 func OptionTextMailBody() ApiOption {
 	return optTextMailBody{}
 }
 
+// Asks for immutable IDs of messages, events and attachments, which unlike the default IDs don't change
+// when the item is moved to another folder.  IDs given to later calls are accepted in either form.
+func OptionImmutableID() ApiOption {
+	return optImmutableID{}
+}
+
+// Makes an update or delete conditional: it fails with ErrConflict if the item's current
+// etag differs, i.e. the item was changed after it was read.  See also the IfMatch methods
+// of Message and Event.
+func OptionIfMatch(etag string) ApiOption {
+	return optIfMatch{etag: etag}
+}
+
+// Returns the weak etag corresponding to an Outlook item's changeKey
+func ETagFromChangeKey(changeKey string) string {
+	return `W/"` + changeKey + `"`
+}
+
+// optionIfMatchItem prefers the item's etag, falling back to one made from its changeKey
+func optionIfMatchItem(etag string, changeKey string) ApiOption {
+	if len(etag) == 0 && len(changeKey) > 0 {
+		etag = ETagFromChangeKey(changeKey)
+	}
+	return optIfMatch{etag: etag}
+}
+
 func OptionSearch(value string) ApiOption {
 	return optSearch{value: value}
 }
 
+// Searches messages with a query built with SearchTerm, SearchAnd, SearchOr, SearchNot and the
+// SearchProperty methods.  Several searches are combined with AND.
+func OptionSearchQuery(query SearchQuery) ApiOption {
+	return optSearchQuery{query: query}
+}
+
 func OptionSelect(field string) ApiOption {
 	return optSelect{field: field}
 }
 
+// Filters by a raw OData expression, which must be escaped by the caller.  See OptionFilterExpr.
+// Several filters are combined with "and".
 func OptionFilter(filter string) ApiOption {
 	return optFilter{filter: filter}
 }
 
+// Filters by an expression built with Field, And, Or and Not
+func OptionFilterExpr(e Expr) ApiOption {
+	return optFilter{filter: e.String()}
+}
+
 func OptionMaxItems(n int) ApiOption {
 	return optMax{n: n}
 }
@@ -115,39 +221,72 @@ func getTextMailBody(options []ApiOption) bool {
 	return false
 }
 
-func formatOptions(apiUrl string, options []ApiOption) (string, error) {
+// getHeaders returns the request headers required by the options
+func getHeaders(options []ApiOption) map[string]string {
+	var prefer []string
+	headers := make(map[string]string)
+	if getTextMailBody(options) {
+		prefer = append(prefer, `outlook.body-content-type="text"`)
+	}
+	for _, o := range options {
+		switch x := o.(type) {
+		case optImmutableID:
+			prefer = append(prefer, `IdType="ImmutableId"`)
+		case optIfMatch:
+			if len(x.etag) > 0 {
+				headers["If-Match"] = x.etag
+			}
+		case optCount, optEventual:
+			headers["ConsistencyLevel"] = "eventual"
+		}
+	}
+	if len(prefer) > 0 {
+		headers["Prefer"] = strings.Join(prefer, ", ")
+	}
+	return headers
+}
+
+func formatOptions(apiUrl string, options ...ApiOption) (string, error) {
 	var (
-		sel                strings.Builder
-		nSrch, nFilt, nSel int
+		sel             strings.Builder
+		nFilt, nSel     int
+		searches        []SearchQuery
+		filters         []Expr
+		orderBy, expand []string
 	)
 	baseUrl, err := url.ParseRequestURI(apiUrl)
 	if err != nil {
 		return "", err
 	}
 	for _, o := range options {
-		switch o.(type) {
+		switch x := o.(type) {
 		case optSearch:
-			nSrch++
+			q := SearchQuery{s: x.value}
+			if len(x.prop) > 0 {
+				q.s = x.prop + ":" + x.value
+			}
+			if strings.ContainsAny(q.s, " \t") {
+				q.op = "raw" // may hold operators, parenthesised if combined
+			}
+			searches = append(searches, q)
+		case optSearchQuery:
+			if x.query.err != nil {
+				return "", x.query.err
+			}
+			if len(x.query.s) == 0 {
+				return "", fmt.Errorf("empty search")
+			}
+			searches = append(searches, x.query)
 		case optFilter:
 			nFilt++
 		}
 	}
-	if nSrch > 1 {
-		return "", fmt.Errorf("cannot have more than one search")
-	} else if nSrch > 0 {
-		if nFilt > 0 {
-			return "", fmt.Errorf("cannot use filter with a search request")
-		}
+	if len(searches) > 0 && nFilt > 0 {
+		return "", fmt.Errorf("cannot use filter with a search request")
 	}
-	params := url.Values{}
+	params := baseUrl.Query()
 	for _, o := range options {
 		switch x := o.(type) {
-		case optSearch:
-			if len(x.prop) > 0 {
-				params.Add("$search", fmt.Sprintf(`"%s:%s"`, x.prop, x.escapeValue()))
-			} else {
-				params.Add("$search", fmt.Sprintf(`"%s"`, x.escapeValue()))
-			}
 		case optSelect:
 			if nSel > 0 {
 				sel.WriteByte(',')
@@ -155,9 +294,21 @@ func formatOptions(apiUrl string, options []ApiOption) (string, error) {
 			sel.WriteString(x.field)
 			nSel++
 		case optFilter:
-			params.Add("$filter", x.filter)
+			filters = append(filters, Raw(x.filter))
 		case optPageSize:
-			params.Add("top", strconv.Itoa(x.n))
+			params.Set("$top", strconv.Itoa(x.n))
+		case optSkip:
+			params.Set("$skip", strconv.Itoa(x.n))
+		case optOrderBy:
+			if x.desc {
+				orderBy = append(orderBy, x.field+" desc")
+			} else {
+				orderBy = append(orderBy, x.field)
+			}
+		case optExpand:
+			expand = append(expand, x.expand)
+		case optCount:
+			params.Set("$count", "true")
 		case optStartDateTime:
 			params.Add("startDateTime", x.when.Format(ISO8601))
 		case optEndDateTime:
@@ -167,13 +318,30 @@ func formatOptions(apiUrl string, options []ApiOption) (string, error) {
 	if nSel > 0 {
 		params.Add("$select", sel.String())
 	}
+	if len(searches) > 0 {
+		params.Add("$search", `"`+escapeSearch(SearchAnd(searches...).s)+`"`)
+	}
+	if len(filters) > 0 {
+		params.Add("$filter", And(filters...).String())
+	}
+	if len(orderBy) > 0 {
+		params.Add("$orderby", strings.Join(orderBy, ","))
+	}
+	if len(expand) > 0 {
+		params.Add("$expand", strings.Join(expand, ","))
+	}
 	baseUrl.RawQuery = params.Encode()
 	return baseUrl.String(), nil
 }
 
 func (o optSearch) escapeValue() string {
+	return escapeSearch(o.value)
+}
+
+// escapeSearch escapes a search for the quoted $search parameter
+func escapeSearch(value string) string {
 	var b strings.Builder
-	for _, r := range o.value {
+	for _, r := range value {
 		switch r {
 		case '"':
 			b.WriteString(`\"`)
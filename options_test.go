@@ -3,6 +3,7 @@ package msgraph
 import (
 	"net/url"
 	"testing"
+	"time"
 )
 
 func TestOptionSearch_escapeValue(t *testing.T) {
@@ -61,6 +62,43 @@ func Test_formatOptions(t *testing.T) {
 				optFilter{"(from/emailAddress/address) eq 'jdoe@acme.com'"},
 			},
 		}, "https://graph.microsoft.com/v1.0/me/messages?$filter=(from/emailAddress/address) eq 'jdoe@acme.com'&$select=sender,body", false},
+		{"query options", args{
+			apiUrl: "https://graph.microsoft.com/v1.0/me/messages",
+			options: []ApiOption{
+				OptionPageSize(10),
+				OptionSkip(20),
+				OptionOrderByDesc("receivedDateTime"),
+				OptionOrderBy("subject"),
+				OptionExpand("attachments"),
+				OptionCount(),
+			},
+		}, "https://graph.microsoft.com/v1.0/me/messages?$count=true&$expand=attachments&$orderby=receivedDateTime desc,subject&$skip=20&$top=10", false},
+		{"combined filters", args{
+			apiUrl: "https://graph.microsoft.com/v1.0/me/messages",
+			options: []ApiOption{
+				OptionFilter("isRead eq false"),
+				OptionFilterExpr(Field("subject").Eq("it's")),
+			},
+		}, "https://graph.microsoft.com/v1.0/me/messages?$filter=(isRead eq false) and (subject eq 'it''s')", false},
+		{"search query", args{
+			apiUrl: "https://graph.microsoft.com/v1.0/me/messages",
+			options: []ApiOption{
+				OptionSearch("budget"),
+				OptionSearchQuery(SearchSubject.Has("it's done")),
+			},
+		}, `https://graph.microsoft.com/v1.0/me/messages?$search="budget AND subject:\"it''s done\""`, false},
+		{"invalid search", args{
+			apiUrl: "https://graph.microsoft.com/v1.0/me/messages",
+			options: []ApiOption{
+				OptionSearchQuery(SearchSubject.After(time.Now())),
+			},
+		}, "", true},
+		{"existing query", args{
+			apiUrl: "https://graph.microsoft.com/v1.0/me/messages?$skiptoken=abc",
+			options: []ApiOption{
+				optSelect{"sender"},
+			},
+		}, "https://graph.microsoft.com/v1.0/me/messages?$select=sender&$skiptoken=abc", false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -69,6 +107,9 @@ func Test_formatOptions(t *testing.T) {
 				t.Errorf("formatOptions() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if err != nil {
+				return
+			}
 			gotUrl, _ := url.ParseRequestURI(got)             // Parse https://host.com/path?escapedquery
 			gotQuery, _ := url.QueryUnescape(gotUrl.RawQuery) // get the unescaped version of thr query
 			gotUrl.RawQuery = ""                              // remove the query from the Url
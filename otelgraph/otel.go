@@ -0,0 +1,182 @@
+// Package otelgraph adds OpenTelemetry tracing and metrics to a msgraph.Client.
+//
+// Each API call gets a span, with a child span for every HTTP request it makes (one per page of a
+// listing and per retry attempt).  Metrics are recorded for calls, HTTP request latency, retries and
+// throttled (HTTP 429) responses.  Export is configured through the usual OpenTelemetry providers,
+// e.g. an OTLP exporter to a local collector or the go.opentelemetry.io/otel/exporters/prometheus
+// exporter registered with a Prometheus registry.
+package otelgraph
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jjcinaz/msgraph"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/jjcinaz/msgraph/otelgraph"
+
+type Options struct {
+	TracerProvider trace.TracerProvider // defaults to the global provider
+	MeterProvider  metric.MeterProvider // defaults to the global provider
+	// RedactURL is applied to URLs before they are recorded.  The default removes the query,
+	// which often holds filters containing personal data.
+	RedactURL func(u *url.URL) string
+}
+
+type instrumentation struct {
+	tracer          trace.Tracer
+	redactURL       func(u *url.URL) string
+	calls           metric.Int64Counter
+	callDuration    metric.Float64Histogram
+	requestDuration metric.Float64Histogram
+	retries         metric.Int64Counter
+	throttled       metric.Int64Counter
+}
+
+// Instrument installs tracing and metrics on c.  It replaces any msgraph.Hooks previously set on the client
+// and appends a middleware.
+func Instrument(c *msgraph.Client, opts Options) error {
+	if opts.TracerProvider == nil {
+		opts.TracerProvider = otel.GetTracerProvider()
+	}
+	if opts.MeterProvider == nil {
+		opts.MeterProvider = otel.GetMeterProvider()
+	}
+	if opts.RedactURL == nil {
+		opts.RedactURL = func(u *url.URL) string {
+			x := *u
+			x.RawQuery = ""
+			return x.String()
+		}
+	}
+	ins := &instrumentation{
+		tracer:    opts.TracerProvider.Tracer(instrumentationName),
+		redactURL: opts.RedactURL,
+	}
+	meter := opts.MeterProvider.Meter(instrumentationName)
+	var err, e error
+	ins.calls, e = meter.Int64Counter("msgraph.client.calls",
+		metric.WithDescription("Graph API calls made"), metric.WithUnit("{call}"))
+	err = errors.Join(err, e)
+	ins.callDuration, e = meter.Float64Histogram("msgraph.client.call.duration",
+		metric.WithDescription("Duration of Graph API calls including all pages and retries"), metric.WithUnit("s"))
+	err = errors.Join(err, e)
+	ins.requestDuration, e = meter.Float64Histogram("http.client.request.duration",
+		metric.WithDescription("Duration of individual HTTP requests to Graph"), metric.WithUnit("s"))
+	err = errors.Join(err, e)
+	ins.retries, e = meter.Int64Counter("msgraph.client.retries",
+		metric.WithDescription("Requests resent after throttling or a transient failure"), metric.WithUnit("{request}"))
+	err = errors.Join(err, e)
+	ins.throttled, e = meter.Int64Counter("msgraph.client.throttled",
+		metric.WithDescription("HTTP 429 responses received from Graph"), metric.WithUnit("{response}"))
+	err = errors.Join(err, e)
+	if err != nil {
+		return err
+	}
+	c.SetHooks(msgraph.Hooks{StartCall: ins.startCall, Retry: ins.retry})
+	c.Use(ins.middleware)
+	return nil
+}
+
+func (ins *instrumentation) startCall(ctx context.Context, method string, apiUrl string) (context.Context, func(error)) {
+	attrs := []attribute.KeyValue{attribute.String("http.request.method", method)}
+	if u, err := url.Parse(apiUrl); err == nil {
+		attrs = append(attrs, attribute.String("url.full", ins.redactURL(u)))
+	}
+	ctx, span := ins.tracer.Start(ctx, "msgraph "+method, trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...))
+	start := time.Now()
+	return ctx, func(err error) {
+		metricAttrs := []attribute.KeyValue{attribute.String("http.request.method", method)}
+		if err != nil {
+			var gerr *msgraph.MsGraphError
+			if errors.As(err, &gerr) {
+				// not every failure carries a Graph error code, the status is the next best type
+				errType := gerr.Code
+				if len(errType) == 0 {
+					errType = strconv.Itoa(gerr.HttpStatusCode)
+				}
+				metricAttrs = append(metricAttrs, attribute.Int("http.response.status_code", gerr.HttpStatusCode),
+					attribute.String("error.type", errType))
+				span.SetAttributes(attribute.String("msgraph.error_code", gerr.Code),
+					attribute.String("msgraph.request_id", gerr.RequestID))
+			} else {
+				metricAttrs = append(metricAttrs, attribute.String("error.type", "_OTHER"))
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		ins.calls.Add(ctx, 1, metric.WithAttributes(metricAttrs...))
+		ins.callDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(metricAttrs...))
+		span.End()
+	}
+}
+
+func (ins *instrumentation) retry(ctx context.Context, method string, attempt int, res *http.Response, err error, wait time.Duration) {
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", method),
+		attribute.Int("msgraph.attempt", attempt),
+		attribute.Float64("msgraph.retry_wait", wait.Seconds()),
+	}
+	if res != nil {
+		attrs = append(attrs, attribute.Int("http.response.status_code", res.StatusCode))
+	}
+	trace.SpanFromContext(ctx).AddEvent("msgraph.retry", trace.WithAttributes(attrs...))
+	ins.retries.Add(ctx, 1, metric.WithAttributes(attrs[0]))
+}
+
+func (ins *instrumentation) middleware(next http.RoundTripper) http.RoundTripper {
+	return msgraph.RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		attrs := []attribute.KeyValue{
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.full", ins.redactURL(r.URL)),
+			attribute.String("server.address", r.URL.Hostname()),
+		}
+		if page := msgraph.RequestPage(r.Context()); page > 0 {
+			attrs = append(attrs, attribute.Int("msgraph.page", page))
+		}
+		if attempt := msgraph.RequestAttempt(r.Context()); attempt > 1 {
+			attrs = append(attrs, attribute.Int("http.request.resend_count", attempt-1))
+		}
+		ctx, span := ins.tracer.Start(r.Context(), r.Method, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attrs...))
+		defer span.End()
+		start := time.Now()
+		res, err := next.RoundTrip(r.WithContext(ctx))
+		metricAttrs := []attribute.KeyValue{attrs[0], attrs[2]}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			metricAttrs = append(metricAttrs, attribute.String("error.type", "_OTHER"))
+		} else {
+			span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode))
+			if id := res.Header.Get("request-id"); len(id) > 0 {
+				span.SetAttributes(attribute.String("msgraph.request_id", id))
+			}
+			if id := res.Header.Get("client-request-id"); len(id) > 0 {
+				span.SetAttributes(attribute.String("msgraph.client_request_id", id))
+			}
+			if res.StatusCode >= 400 {
+				span.SetStatus(codes.Error, res.Status)
+			}
+			if res.StatusCode == http.StatusTooManyRequests {
+				span.AddEvent("msgraph.throttled",
+					trace.WithAttributes(attribute.String("http.response.header.retry-after", res.Header.Get("Retry-After"))))
+				ins.throttled.Add(ctx, 1, metric.WithAttributes(attrs[0]))
+			}
+			metricAttrs = append(metricAttrs, attribute.Int("http.response.status_code", res.StatusCode))
+		}
+		ins.requestDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(metricAttrs...))
+		return res, err
+	})
+}
@@ -0,0 +1,119 @@
+package otelgraph
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jjcinaz/msgraph"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrument(t *testing.T) {
+	var meCalls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/tenant/oauth2/v2.0/token":
+			io.WriteString(w, `{"access_token":"abc","token_type":"Bearer","expires_in":3600}`)
+		case "/v1.0/me":
+			meCalls++
+			if meCalls == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				io.WriteString(w, `{"error":{"code":"TooManyRequests","message":"slow down"}}`)
+				return
+			}
+			io.WriteString(w, `{"id":"1"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound) // no Graph error body
+		}
+	}))
+	defer srv.Close()
+
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	c, err := msgraph.NewKeyClient(context.Background(), "tenant", "client", "secret",
+		msgraph.WithAuthorityHost(srv.URL), msgraph.WithGraphEndpoint(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Instrument(c, Options{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Do(msgraph.Request{Path: "/me", Options: []msgraph.ApiOption{msgraph.OptionSelect("id")}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Do(msgraph.Request{Path: "/missing"}, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 5 {
+		t.Fatalf("got %d spans, want 2 calls and 3 HTTP requests", len(ended))
+	}
+	call := ended[2]
+	if call.Name() != "msgraph GET" || call.SpanKind() != trace.SpanKindInternal || len(call.Events()) != 1 ||
+		call.Events()[0].Name != "msgraph.retry" {
+		t.Errorf("unexpected call span %s %v %v", call.Name(), call.SpanKind(), call.Events())
+	}
+	for _, s := range ended[:2] {
+		if s.SpanKind() != trace.SpanKindClient || s.Parent().SpanID() != call.SpanContext().SpanID() {
+			t.Errorf("request span %s is not a child of the call", s.Name())
+		}
+		if v := attr(s.Attributes(), "url.full"); v != srv.URL+"/v1.0/me" {
+			t.Errorf("url.full = %q, want the query removed", v)
+		}
+	}
+	if attr(ended[1].Attributes(), "http.request.resend_count") != "1" || len(ended[0].Events()) != 1 {
+		t.Errorf("retry not recorded on the request spans")
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err = reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	sums := make(map[string][]metricdata.DataPoint[int64])
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if s, ok := m.Data.(metricdata.Sum[int64]); ok {
+				sums[m.Name] = s.DataPoints
+			}
+		}
+	}
+	if p := sums["msgraph.client.retries"]; len(p) != 1 || p[0].Value != 1 {
+		t.Errorf("retries = %+v", p)
+	}
+	if p := sums["msgraph.client.throttled"]; len(p) != 1 || p[0].Value != 1 {
+		t.Errorf("throttled = %+v", p)
+	}
+	var errTypes []string
+	for _, p := range sums["msgraph.client.calls"] {
+		if v, ok := p.Attributes.Value("error.type"); ok {
+			errTypes = append(errTypes, v.AsString())
+		}
+	}
+	if len(sums["msgraph.client.calls"]) != 2 || len(errTypes) != 1 || errTypes[0] != "404" {
+		t.Errorf("calls = %+v, want one success and one failure with error.type 404", sums["msgraph.client.calls"])
+	}
+}
+
+func attr(attrs []attribute.KeyValue, key attribute.Key) string {
+	for _, a := range attrs {
+		if a.Key == key {
+			return a.Value.Emit()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,141 @@
+package msgraph
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Pager walks a paged Graph listing one item at a time, requesting each page only when the
+// previous one has been consumed.  Typical use:
+//
+//	p, err := c.ListMessagesPager("bob@acme.com")
+//	for p.Next() {
+//		m := p.Item()
+//	}
+//	err = p.Err()
+//
+// The position of a crawl can be saved with Checkpoint and continued later with ResumePager.
+type Pager[T any] struct {
+	client   *Client
+	headers  map[string]string
+	pageLink string
+	nextLink string
+	page     []T
+	index    int
+	max      int
+	count    int
+	pages    int // fetched so far
+	total    int // @odata.count, -1 if not known
+	err      error
+}
+
+func newPager[T any](c *Client, apiUrl string, options []ApiOption) *Pager[T] {
+	return &Pager[T]{
+		client:   c,
+		headers:  getHeaders(options),
+		nextLink: apiUrl,
+		max:      getMaxItemOption(options),
+		total:    -1,
+	}
+}
+
+// Creates a Pager which continues a listing from a link previously returned by Checkpoint or NextLink.
+// Options which add request headers (e.g. OptionTextMailBody) or limit the items (OptionMaxItems)
+// must be supplied again; query options are already part of the link.  A link off the Graph endpoint
+// is refused, as the checkpoint may have been stored somewhere it could be altered.
+func ResumePager[T any](c *Client, link string, options ...ApiOption) (*Pager[T], error) {
+	if len(link) > 0 { // an empty checkpoint is a finished listing
+		var err error
+		if link, err = c.resolvePath(link, nil); err != nil {
+			return nil, err
+		}
+	}
+	return newPager[T](c, link, options), nil
+}
+
+// Advances to the next item, fetching the next page if required.  Returns false when the listing
+// is exhausted, the OptionMaxItems limit is reached, or an error occurred (see Err).
+func (p *Pager[T]) Next() bool {
+	for p.err == nil && p.count < p.max {
+		if p.index < len(p.page) {
+			p.index++
+			p.count++
+			return true
+		}
+		if len(p.nextLink) == 0 || !p.fetch() {
+			return false
+		}
+	}
+	return false
+}
+
+// Returns the current item; only valid after Next has returned true
+func (p *Pager[T]) Item() T {
+	return p.page[p.index-1]
+}
+
+func (p *Pager[T]) Err() error {
+	return p.err
+}
+
+// Returns the link of the page following the one currently held, or an empty string on the last page
+func (p *Pager[T]) NextLink() string {
+	return p.nextLink
+}
+
+// Returns a link from which ResumePager continues the listing without skipping any item not yet
+// returned by Next.  If the current page is only partly consumed this is the link of that page, so some
+// items may be returned again after resuming.  An empty string means the listing is complete.
+func (p *Pager[T]) Checkpoint() string {
+	if p.index < len(p.page) {
+		return p.pageLink
+	}
+	return p.nextLink
+}
+
+// Returns the total number of items reported by the server when OptionCount was given, or -1.
+// It is known once the first page has been fetched.
+func (p *Pager[T]) TotalCount() int {
+	return p.total
+}
+
+// Reads all remaining items into a slice
+func (p *Pager[T]) Collect() ([]T, error) {
+	list := make([]T, 0, 64)
+	for p.Next() {
+		list = append(list, p.Item())
+	}
+	return list, p.Err()
+}
+
+func (p *Pager[T]) fetch() bool {
+	var (
+		reply struct {
+			Nextlink string `json:"@odata.nextLink"`
+			Count    *int   `json:"@odata.count"`
+			Data     []T    `json:"value"`
+		}
+		decodeErr error
+	)
+	link := p.nextLink
+	err := p.client.executeGetPages(link, p.pages+1, p.headers, func(body io.Reader) string {
+		decodeErr = json.NewDecoder(body).Decode(&reply)
+		return "" // one page at a time
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		p.err = err
+		return false
+	}
+	p.pages++
+	p.pageLink = link
+	p.nextLink = reply.Nextlink
+	p.page = reply.Data
+	if reply.Count != nil {
+		p.total = *reply.Count
+	}
+	p.index = 0
+	return true
+}
@@ -0,0 +1,109 @@
+package msgraph
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// newPagedServer serves /v1.0/items as pages of the given items, following @odata.nextLink
+func newPagedServer(t *testing.T, pages [][]int, requests *[]string) *Client {
+	var base string
+	c, srv := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.RawQuery)
+		n := 0
+		if v := r.URL.Query().Get("page"); len(v) > 0 {
+			n = int(v[0] - '0')
+		}
+		reply := map[string]interface{}{"value": pages[n], "@odata.count": 7}
+		if n+1 < len(pages) {
+			reply["@odata.nextLink"] = base + "/v1.0/items?page=" + string(rune('0'+n+1))
+		}
+		json.NewEncoder(w).Encode(reply)
+	})
+	base = srv.URL
+	return c
+}
+
+func TestPager(t *testing.T) {
+	var requests []string
+	c := newPagedServer(t, [][]int{{1, 2, 3}, {4, 5}, {6, 7}}, &requests)
+	apiUrl, _ := formatOptions(c.graphUrl("/items"), OptionCount())
+	p := newPager[int](c, apiUrl, []ApiOption{OptionCount()})
+	if p.TotalCount() != -1 {
+		t.Errorf("TotalCount() = %d before the first page, want -1", p.TotalCount())
+	}
+	var got []int
+	for p.Next() {
+		got = append(got, p.Item())
+		if len(got) == 1 && p.TotalCount() != 7 {
+			t.Errorf("TotalCount() = %d, want 7", p.TotalCount())
+		}
+	}
+	if p.Err() != nil || len(got) != 7 || got[6] != 7 || len(requests) != 3 {
+		t.Errorf("got %v in %d requests, err %v", got, len(requests), p.Err())
+	}
+	if p.NextLink() != "" || p.Checkpoint() != "" {
+		t.Errorf("links after the last page: %q %q", p.NextLink(), p.Checkpoint())
+	}
+}
+
+func TestPager_maxItems(t *testing.T) {
+	var requests []string
+	c := newPagedServer(t, [][]int{{1, 2, 3}, {4, 5}, {6, 7}}, &requests)
+	got, err := newPager[int](c, c.graphUrl("/items"), []ApiOption{OptionMaxItems(4)}).Collect()
+	if err != nil || len(got) != 4 || got[3] != 4 || len(requests) != 2 {
+		t.Errorf("got %v in %d requests, err %v, want 4 items in 2 requests", got, len(requests), err)
+	}
+}
+
+func TestPager_checkpoint(t *testing.T) {
+	var requests []string
+	c := newPagedServer(t, [][]int{{1, 2, 3}, {4, 5}, {6, 7}}, &requests)
+	p := newPager[int](c, c.graphUrl("/items"), nil)
+	for i := 0; i < 4; i++ {
+		p.Next()
+	}
+	// part way through the second page, which is where a resumed crawl starts again
+	checkpoint := p.Checkpoint()
+	if !strings.HasSuffix(checkpoint, "page=1") || !strings.HasSuffix(p.NextLink(), "page=2") {
+		t.Fatalf("Checkpoint() = %q, NextLink() = %q", checkpoint, p.NextLink())
+	}
+	resumed, err := ResumePager[int](c, checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := resumed.Collect()
+	if err != nil || len(got) != 4 || got[0] != 4 {
+		t.Errorf("resumed with %v, err %v, want [4 5 6 7]", got, err)
+	}
+	n := len(requests)
+	if _, err = ResumePager[int](c, "https://evil.example.com/v1.0/items?page=1"); err == nil {
+		t.Error("ResumePager() accepted a link off the Graph endpoint")
+	}
+	if finished, err := ResumePager[int](c, ""); err != nil || finished.Next() {
+		t.Errorf("ResumePager() of a finished listing returned items, err %v", err)
+	}
+
+	if len(requests) != n {
+		t.Errorf("requests made by an evil or finished checkpoint: %v", requests[n:])
+	}
+
+	p.Next() // consumes the last item of the second page
+	if checkpoint = p.Checkpoint(); !strings.HasSuffix(checkpoint, "page=2") {
+		t.Errorf("Checkpoint() = %q at the end of a page, want the next page", checkpoint)
+	}
+}
+
+func TestGetUserListPager_options(t *testing.T) {
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {})
+	options := make([]ApiOption, 1, 10)
+	options[0] = OptionPageSize(5)
+	if _, err := c.GetUserListPager(options...); err != nil {
+		t.Fatal(err)
+	}
+	if extra := options[:2][1]; extra != nil {
+		t.Errorf("GetUserListPager appended %v to the caller's options", extra)
+	}
+}
@@ -0,0 +1,169 @@
+// Package rediscache stores msgraph tokens in Redis so that replicas of a service share them.
+//
+// Tokens are kept under Options.Prefix followed by msgraph.CacheKey, and expire when they haven't
+// been saved for Options.TTL.  A client that doesn't know its account yet, as when NewClient or
+// NewDeviceCodeClient start, loads the only token kept for its tenant and application.
+//
+// Refreshes are serialised across replicas with a lease held in Redis, so that only one of them redeems a
+// refresh token; the others then load the token it saved.  Optimistic locking, saving only if the token is
+// unchanged, would detect the conflict only after both replicas had redeemed the refresh token, and the
+// loser's rotated refresh token would be lost.  The lease expires after Options.LockTTL so that a replica
+// dying while it refreshes doesn't block the others.
+package rediscache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+
+	"github.com/jjcinaz/msgraph"
+	"github.com/jjcinaz/msgraph/cachecrypt"
+)
+
+type Options struct {
+	Prefix     string                // prepended to keys, default "msgraph:token:"
+	TTL        time.Duration         // evict tokens not saved for this long, default 90 days
+	LockTTL    time.Duration         // lease of the refresh lock, in case a replica dies holding it, default 30s
+	Encryption cachecrypt.KeyWrapper // encrypts token blobs when set
+}
+
+type Cache struct {
+	rdb  redis.UniversalClient
+	opts Options
+}
+
+const lockPoll = 50 * time.Millisecond
+
+// unlockScript deletes the lock only if it is still ours, and not a lease taken over after ours expired
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+func New(rdb redis.UniversalClient, opts Options) *Cache {
+	if len(opts.Prefix) == 0 {
+		opts.Prefix = "msgraph:token:"
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 90 * 24 * time.Hour
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = 30 * time.Second
+	}
+	return &Cache{rdb: rdb, opts: opts}
+}
+
+func (rc *Cache) Load(c *msgraph.Client) (*oauth2.Token, error) {
+	ctx := c.Context()
+	key := c.CacheKey()
+	name := key.String()
+	blob, err := rc.rdb.Get(ctx, rc.opts.Prefix+name).Bytes()
+	if errors.Is(err, redis.Nil) && len(key.Account) == 0 {
+		if name, err = rc.onlyKey(ctx, name); err == nil {
+			blob, err = rc.rdb.Get(ctx, rc.opts.Prefix+name).Bytes()
+		}
+	}
+	if errors.Is(err, redis.Nil) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	if blob, err = cachecrypt.Open(ctx, rc.opts.Encryption, name, blob); err != nil {
+		return nil, err
+	}
+	return msgraph.UnmarshalToken(blob)
+}
+
+func (rc *Cache) Save(c *msgraph.Client, token *oauth2.Token) error {
+	ctx := c.Context()
+	blob, err := msgraph.MarshalToken(token)
+	if err != nil {
+		return err
+	}
+	if blob, err = cachecrypt.Seal(ctx, rc.opts.Encryption, c.CacheKey().String(), blob); err != nil {
+		return err
+	}
+	return rc.rdb.Set(ctx, rc.key(c.CacheKey()), blob, rc.opts.TTL).Err()
+}
+
+// Lock implements msgraph.TokenLocker, waiting until no other replica is refreshing the client's token
+func (rc *Cache) Lock(ctx context.Context, c *msgraph.Client) (func(), error) {
+	lockKey := rc.key(c.CacheKey()) + ":lock"
+	owner := make([]byte, 16)
+	if _, err := rand.Read(owner); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(owner)
+	for {
+		ok, err := rc.rdb.SetNX(ctx, lockKey, id, rc.opts.LockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+	return func() {
+		_ = unlockScript.Run(context.Background(), rc.rdb, []string{lockKey}, id).Err()
+	}, nil
+}
+
+// Removes the token stored for key, e.g. to sign a user out
+func (rc *Cache) Remove(ctx context.Context, key msgraph.CacheKey) error {
+	return rc.rdb.Del(ctx, rc.key(key)).Err()
+}
+
+// onlyKey returns the cache key of the only token whose key starts with prefix, or redis.Nil.
+// SCAN only covers one node, so every master of a cluster is scanned.
+func (rc *Cache) onlyKey(ctx context.Context, prefix string) (string, error) {
+	var mu sync.Mutex
+	found := make(map[string]bool) // SCAN may return a key more than once
+	scan := func(ctx context.Context, rdb redis.Cmdable) error {
+		iter := rdb.Scan(ctx, 0, globEscaper.Replace(rc.opts.Prefix+prefix)+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			if key := iter.Val(); !strings.HasSuffix(key, ":lock") {
+				mu.Lock()
+				found[strings.TrimPrefix(key, rc.opts.Prefix)] = true
+				mu.Unlock()
+			}
+		}
+		return iter.Err()
+	}
+	var err error
+	if cluster, ok := rc.rdb.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scan(ctx, node)
+		})
+	} else {
+		err = scan(ctx, rc.rdb)
+	}
+	if err != nil {
+		return "", err
+	}
+	for key := range found {
+		if len(found) == 1 {
+			return key, nil
+		}
+	}
+	return "", redis.Nil
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+func (rc *Cache) key(key msgraph.CacheKey) string {
+	return rc.opts.Prefix + key.String()
+}
@@ -0,0 +1,134 @@
+package rediscache
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+
+	"github.com/jjcinaz/msgraph"
+	"github.com/jjcinaz/msgraph/cachecrypt"
+)
+
+func testClient(t *testing.T) *msgraph.Client {
+	wa := msgraph.NewWebAuth("tenant", "client", "", "http://localhost/cb", nil, nil)
+	c, err := wa.ClientFromToken(context.Background(), &oauth2.Token{AccessToken: "at"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func accountClient(t *testing.T, oid string) *msgraph.Client {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"oid":"` + oid + `","tid":"tenant"}`))
+	token := (&oauth2.Token{AccessToken: "at-" + oid}).WithExtra(map[string]interface{}{"id_token": "e30." + claims + ".sig"})
+	wa := msgraph.NewWebAuth("tenant", "client", "", "http://localhost/cb", nil, nil)
+	c, err := wa.ClientFromToken(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	kw, _ := cachecrypt.NewAESKeyWrapper(bytes.Repeat([]byte{7}, 32))
+	rc := New(rdb, Options{TTL: time.Hour, Encryption: kw})
+	c := testClient(t)
+
+	if _, err := rc.Load(c); !os.IsNotExist(err) {
+		t.Errorf("Load() from an empty cache error = %v", err)
+	}
+	saved := (&oauth2.Token{AccessToken: "at", RefreshToken: "rt"}).WithExtra(map[string]interface{}{"id_token": "e30.e30.sig"})
+	if err := rc.Save(c, saved); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := mr.Get("msgraph:token:" + c.CacheKey().String())
+	if bytes.Contains([]byte(raw), []byte("refresh_token")) {
+		t.Error("token stored unencrypted")
+	}
+	token, err := rc.Load(c)
+	if err != nil || token.RefreshToken != "rt" || token.Extra("id_token") != "e30.e30.sig" {
+		t.Fatalf("Load() = %v, %v", token, err)
+	}
+
+	mr.FastForward(2 * time.Hour)
+	if _, err = rc.Load(c); !os.IsNotExist(err) {
+		t.Errorf("Load() after the TTL error = %v", err)
+	}
+}
+
+func TestCache_Lock(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer rdb.Close()
+	replica1, replica2 := New(rdb, Options{}), New(rdb, Options{})
+	c := testClient(t)
+
+	unlock, err := replica1.Lock(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err = replica2.Lock(ctx, c); err == nil {
+		t.Fatal("Lock() succeeded while another replica held it")
+	}
+	unlock()
+	unlock2, err := replica2.Lock(context.Background(), c)
+	if err != nil {
+		t.Fatalf("Lock() after unlock error = %v", err)
+	}
+	unlock2()
+}
+
+func TestCache_onlyAccount(t *testing.T) {
+	t.Run("standalone", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		testOnlyAccount(t, mr, redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	})
+	t.Run("cluster", func(t *testing.T) {
+		mr := miniredis.RunT(t)
+		testOnlyAccount(t, mr, redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{mr.Addr()}}))
+	})
+}
+
+func testOnlyAccount(t *testing.T, mr *miniredis.Miniredis, rdb redis.UniversalClient) {
+	defer rdb.Close()
+	kw, _ := cachecrypt.NewAESKeyWrapper(bytes.Repeat([]byte{7}, 32))
+	rc := New(rdb, Options{Encryption: kw})
+	alice, bob, starting := accountClient(t, "alice"), accountClient(t, "bob"), testClient(t)
+	if err := rc.Save(alice, &oauth2.Token{AccessToken: "at-alice"}); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := rc.Lock(context.Background(), alice) // lock keys are not tokens
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	// a client that doesn't know its account yet gets the only one cached
+	if token, err := rc.Load(starting); err != nil || token.AccessToken != "at-alice" {
+		t.Errorf("Load() = %v, %v, want alice's token", token, err)
+	}
+	if err = rc.Save(bob, &oauth2.Token{AccessToken: "at-bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rc.Load(starting); !os.IsNotExist(err) {
+		t.Errorf("Load() with two accounts cached error = %v", err)
+	}
+
+	// a token copied to another account's key cannot be decrypted
+	blob, _ := mr.Get(rc.key(alice.CacheKey()))
+	mr.Set(rc.key(bob.CacheKey()), blob)
+	if token, err := rc.Load(bob); err == nil {
+		t.Errorf("Load() of a swapped token = %v", token)
+	}
+}
@@ -0,0 +1,123 @@
+package msgraph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Request describes an arbitrary Graph API call for Do, giving access to endpoints the library
+// doesn't wrap with the same authentication, retries, logging and error handling.
+type Request struct {
+	Method      string            // defaults to GET
+	Path        string            // relative to the API version, e.g. "/users/bob@acme.com/mailboxSettings"
+	Options     []ApiOption       // query options such as OptionSelect or OptionFilter
+	Headers     map[string]string // additional request headers
+	Body        interface{}       // sent as JSON, unless it is a []byte or io.Reader which is sent as is
+	ContentType string            // content type of a []byte or io.Reader body, default application/octet-stream
+}
+
+// Performs req and decodes a successful response into out.  out may be nil to discard the response,
+// a *[]byte to receive the raw body, an io.Writer to which the body is copied, or anything else
+// to decode the body as JSON.  Failures are returned as *MsGraphError.
+func (c *Client) Do(req Request, out interface{}) error {
+	apiUrl, err := c.resolvePath(req.Path, req.Options)
+	if err != nil {
+		return err
+	}
+	method := strings.ToUpper(req.Method)
+	if len(method) == 0 {
+		method = "GET"
+	}
+	headers := getHeaders(req.Options)
+	for k, v := range req.Headers {
+		headers[k] = v
+	}
+	var body []byte
+	switch x := req.Body.(type) {
+	case nil:
+	case []byte:
+		body = x
+	case io.Reader:
+		// read fully so the body can be replayed by retries
+		if body, err = ioutil.ReadAll(x); err != nil {
+			return err
+		}
+	default:
+		if body, err = json.Marshal(x); err != nil {
+			return err
+		}
+		headers["Content-Type"] = "application/json"
+	}
+	if _, ok := headers["Content-Type"]; !ok && body != nil {
+		headers["Content-Type"] = "application/octet-stream"
+		if len(req.ContentType) > 0 {
+			headers["Content-Type"] = req.ContentType
+		}
+	}
+	return c.executeRequest(method, apiUrl, headers, body, func(reader io.Reader) error {
+		switch x := out.(type) {
+		case nil:
+			return nil
+		case *[]byte:
+			var b bytes.Buffer
+			_, err := b.ReadFrom(reader)
+			*x = b.Bytes()
+			return err
+		case io.Writer:
+			_, err := io.Copy(x, reader)
+			return err
+		default:
+			err := json.NewDecoder(reader).Decode(out)
+			if err == io.EOF {
+				// no content
+				return nil
+			}
+			return err
+		}
+	})
+}
+
+// Lists every item of a collection at path, e.g.
+//
+//	contacts, err := msgraph.List[Contact](c, "/users/bob@acme.com/contacts", msgraph.OptionMaxItems(50))
+func List[T any](c *Client, path string, options ...ApiOption) ([]T, error) {
+	p, err := NewPager[T](c, path, options...)
+	if err != nil {
+		return nil, err
+	}
+	return p.Collect()
+}
+
+// Creates a Pager over the collection at path
+func NewPager[T any](c *Client, path string, options ...ApiOption) (*Pager[T], error) {
+	apiUrl, err := c.resolvePath(path, options)
+	if err != nil {
+		return nil, err
+	}
+	return newPager[T](c, apiUrl, options), nil
+}
+
+// resolvePath makes an absolute URL of path, which may already be an absolute URL on the Graph endpoint
+// such as a nextLink, and adds the query options
+func (c *Client) resolvePath(path string, options []ApiOption) (string, error) {
+	apiUrl := path
+	if strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://") {
+		if !strings.HasPrefix(path, c.graphEndpoint+"/") {
+			// never send our token anywhere other than the Graph endpoint
+			return "", fmt.Errorf("%s is not on the Graph endpoint %s", path, c.graphEndpoint)
+		}
+	} else {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		apiUrl = c.graphUrl(path)
+	}
+	if len(options) == 0 {
+		return apiUrl, nil
+	}
+	return formatOptions(apiUrl, options...)
+}
@@ -0,0 +1,84 @@
+package msgraph
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestClient_Do(t *testing.T) {
+	type received struct {
+		method, path, query, contentType, body string
+	}
+	var got []received
+	c, srv := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got = append(got, received{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type"), string(body)})
+		switch r.URL.Path {
+		case "/v1.0/me/photo/$value":
+			w.Header().Set("Content-Type", "image/jpeg")
+			w.Write([]byte{0xff, 0xd8, 0xff})
+		case "/v1.0/me/sendMail":
+			w.WriteHeader(http.StatusAccepted)
+		case "/v1.0/me/events":
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id":"e1","subject":"hi"}`))
+		default:
+			w.Write([]byte(`{"id":"1","displayName":"Bob"}`))
+		}
+	})
+
+	var raw []byte
+	if err := c.Do(Request{Path: "/me/photo/$value"}, &raw); err != nil || !bytes.Equal(raw, []byte{0xff, 0xd8, 0xff}) {
+		t.Errorf("raw body %x, err %v", raw, err)
+	}
+	var buf bytes.Buffer
+	if err := c.Do(Request{Path: "me/photo/$value"}, &buf); err != nil || buf.Len() != 3 {
+		t.Errorf("writer received %d bytes, err %v", buf.Len(), err)
+	}
+	var me struct{ ID, DisplayName string }
+	if err := c.Do(Request{Path: "/me", Options: []ApiOption{OptionSelect("displayName")}}, &me); err != nil || me.DisplayName != "Bob" {
+		t.Errorf("decoded %+v, err %v", me, err)
+	}
+	var event struct{ ID string }
+	if err := c.Do(Request{Method: "post", Path: "/me/events", Body: map[string]string{"subject": "hi"}}, &event); err != nil || event.ID != "e1" {
+		t.Errorf("created %+v, err %v", event, err)
+	}
+	// 202 Accepted without a body, decoded by Do and by the internal JSON helpers
+	if err := c.Do(Request{Method: "POST", Path: "/me/sendMail", Body: []byte("MIME"), ContentType: "text/plain"}, &event); err != nil {
+		t.Errorf("empty 202 gave %v", err)
+	}
+	if err := c.executeGetJson(c.graphUrl("/me/sendMail"), &event); err != nil {
+		t.Errorf("executeGetJson() of an empty 202 gave %v", err)
+	}
+	if err := c.Do(Request{Method: "PUT", Path: "/me/photo/$value", Body: strings.NewReader("jpeg")}, nil); err != nil {
+		t.Error(err)
+	}
+
+	want := []received{
+		{"GET", "/v1.0/me/photo/$value", "", "", ""},
+		{"GET", "/v1.0/me/photo/$value", "", "", ""},
+		{"GET", "/v1.0/me", "%24select=displayName", "", ""},
+		{"POST", "/v1.0/me/events", "", "application/json", `{"subject":"hi"}`},
+		{"POST", "/v1.0/me/sendMail", "", "text/plain", "MIME"},
+		{"GET", "/v1.0/me/sendMail", "", "", ""},
+		{"PUT", "/v1.0/me/photo/$value", "", "application/octet-stream", "jpeg"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d requests, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if err := c.Do(Request{Path: srv.URL + "/v1.0/me"}, nil); err != nil {
+		t.Errorf("absolute Graph URL rejected: %v", err)
+	}
+	if err := c.Do(Request{Path: "https://evil.example.com/v1.0/me"}, nil); err == nil {
+		t.Error("URL off the Graph endpoint accepted")
+	}
+}
@@ -0,0 +1,192 @@
+package msgraph
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// RetryPolicy controls how the client reacts to throttling (HTTP 429), transient server
+// failures (HTTP 502, 503, 504) and network errors.
+// See https://docs.microsoft.com/en-us/graph/throttling
+type RetryPolicy struct {
+	MaxAttempts       int           // total attempts for one request, including the first; 1 disables retries
+	MaxWait           time.Duration // upper bound on the total time spent waiting between attempts of one request
+	BaseDelay         time.Duration // first backoff delay when the server doesn't supply a Retry-After
+	MaxDelay          time.Duration // cap on a single exponential backoff delay
+	IdempotentMethods []string      // methods which may be resent after a network error or 5xx
+}
+
+// DefaultRetryPolicy is applied to every new Client.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:       5,
+	MaxWait:           2 * time.Minute,
+	BaseDelay:         500 * time.Millisecond,
+	MaxDelay:          30 * time.Second,
+	IdempotentMethods: []string{"GET", "HEAD", "OPTIONS", "PUT", "DELETE"},
+}
+
+// Sets the retry policy used for all subsequent calls.  Use a policy with
+// MaxAttempts of 1 to disable retries entirely.
+func (c *Client) SetRetryPolicy(policy RetryPolicy) {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	c.retry = policy
+}
+
+func (p RetryPolicy) isIdempotent(method string) bool {
+	for _, m := range p.IdempotentMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns an exponentially increasing delay with full jitter for the given attempt (1 based)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	if d <= 0 {
+		d = DefaultRetryPolicy.BaseDelay
+	}
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// delay decides if a failed attempt should be retried and how long to wait first.
+// Throttled requests were not processed by Graph so they are always safe to resend;
+// other failures are only retried for idempotent methods.
+func (p RetryPolicy) delay(method string, attempt int, res *http.Response, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if err != nil {
+		var authErr *oauth2.RetrieveError
+		if errors.As(err, &authErr) {
+			// the token endpoint refused us, sending again won't help
+			return 0, false
+		}
+		return p.backoff(attempt), p.isIdempotent(method)
+	}
+	wait, hasRetryAfter := parseRetryAfter(res.Header.Get("Retry-After"))
+	switch res.StatusCode {
+	case http.StatusTooManyRequests:
+		if !hasRetryAfter {
+			wait = p.backoff(attempt)
+		}
+		return wait, true
+	case http.StatusServiceUnavailable:
+		if hasRetryAfter {
+			return wait, true
+		}
+		return p.backoff(attempt), p.isIdempotent(method)
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return p.backoff(attempt), p.isIdempotent(method)
+	}
+	return 0, false
+}
+
+// parseRetryAfter understands both forms of the Retry-After header, delay-seconds and HTTP-date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			secs = 0
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		d := time.Until(when)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// send performs one logical request, resending it as dictated by the client's RetryPolicy.
+// The body is held as a byte slice so that it can be replayed on each attempt.  A wait which would
+// run past the context deadline or the policy's MaxWait is not attempted; the last failure is
+// returned instead.
+func (c *Client) send(ctx context.Context, method string, apiUrl string, headers map[string]string, body []byte) (*http.Response, error) {
+	var waited time.Duration
+	httpClient := c.getHttpClient(ctx)
+	for attempt := 1; ; attempt++ {
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(context.WithValue(ctx, attemptKey, attempt), method, apiUrl, bodyReader)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range headers {
+			req.Header.Add(k, v)
+		}
+		res, err := httpClient.Do(req)
+		if ctx.Err() != nil {
+			return res, err
+		}
+		wait, retry := c.retry.delay(method, attempt, res, err)
+		if !retry {
+			return res, err
+		}
+		if c.retry.MaxWait > 0 && waited+wait > c.retry.MaxWait {
+			return res, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return res, err
+		}
+		if res != nil {
+			// drain so the connection can be reused
+			_, _ = io.Copy(ioutil.Discard, res.Body)
+			_ = res.Body.Close()
+		}
+		if c.apilog != nil {
+			if err != nil {
+				c.apilog.Printf("%s %s failed (%v), retrying in %v", method, apiUrl, err, wait)
+			} else {
+				c.apilog.Printf("%s %s returned %s, retrying in %v", method, apiUrl, res.Status, wait)
+			}
+		}
+		if c.hooks.Retry != nil {
+			c.hooks.Retry(ctx, method, attempt, res, err, wait)
+		}
+		if c.logger != nil {
+			attrs := []slog.Attr{slog.String("method", method), slog.String("url", c.logger.redactURL(req.URL)),
+				slog.Int("attempt", attempt), slog.Duration("wait", wait)}
+			if res != nil {
+				attrs = append(attrs, slog.Int("status", res.StatusCode))
+			}
+			c.logger.logger.LogAttrs(ctx, slog.LevelInfo, "graph request retry", attrs...)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		waited += wait
+	}
+}
@@ -0,0 +1,183 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_parseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"empty", "", 0, false},
+		{"seconds", "7", 7 * time.Second, true},
+		{"negative", "-3", 0, true},
+		{"past date", "Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+		{"garbage", "soon", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("parseRetryAfter() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestClient_executeGetList_throttledPage(t *testing.T) {
+	var page2Calls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token":"abc","token_type":"Bearer","expires_in":3600}`)
+	})
+	var srv *httptest.Server
+	mux.HandleFunc("/page1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"@odata.nextLink": srv.URL + "/page2", "value": []int{1, 2}})
+	})
+	mux.HandleFunc("/page2", func(w http.ResponseWriter, r *http.Request) {
+		page2Calls++
+		if page2Calls < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"error":{"code":"TooManyRequests","message":"slow down"}}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": []int{3}})
+	})
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, _ := NewKeyClient(context.Background(), "tenant", "client", "key")
+	c.ccConfig.TokenURL = srv.URL + "/token"
+	var got []int
+	err := c.executeGetList(srv.URL+"/page1", nil, func(body io.Reader) string {
+		var reply struct {
+			Nextlink string `json:"@odata.nextLink"`
+			Data     []int  `json:"value"`
+		}
+		if json.NewDecoder(body).Decode(&reply) != nil {
+			return ""
+		}
+		got = append(got, reply.Data...)
+		return reply.Nextlink
+	})
+	if err != nil {
+		t.Fatalf("executeGetList() error = %v", err)
+	}
+	if len(got) != 3 || page2Calls != 3 {
+		t.Errorf("executeGetList() got %v after %d calls to page2, want [1 2 3] after 3", got, page2Calls)
+	}
+
+	page2Calls = 0
+	c.SetRetryPolicy(RetryPolicy{MaxAttempts: 2})
+	err = c.executeGetList(srv.URL+"/page2", nil, func(body io.Reader) string { return "" })
+	if e, ok := err.(*MsGraphError); !ok || e.StatusCode() != http.StatusTooManyRequests {
+		t.Errorf("executeGetList() error = %v, want HTTP 429", err)
+	}
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 40 * time.Millisecond}
+	var above int
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(1); d < 0 || d > 10*time.Millisecond {
+			t.Fatalf("backoff(1) = %v, want at most the base delay", d)
+		}
+		d := p.backoff(5)
+		if d < 0 || d > 40*time.Millisecond {
+			t.Fatalf("backoff(5) = %v, want at most the max delay", d)
+		}
+		if d > 10*time.Millisecond {
+			above++
+		}
+	}
+	if above == 0 {
+		t.Error("backoff(5) never grew beyond the base delay")
+	}
+}
+
+func TestClient_send(t *testing.T) {
+	type reply struct {
+		status     int
+		retryAfter string
+		netErr     bool // fail the attempt without reaching the server
+	}
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond,
+		IdempotentMethods: DefaultRetryPolicy.IdempotentMethods}
+	tests := []struct {
+		name       string
+		method     string
+		policy     RetryPolicy
+		timeout    time.Duration
+		replies    []reply
+		wantCalls  int
+		wantStatus int // 0 for a network error
+	}{
+		{"5xx backoff", "GET", policy, 0, []reply{{status: 503}, {status: 502}, {status: 200}}, 3, 200},
+		{"network error", "GET", policy, 0, []reply{{netErr: true}, {status: 200}}, 2, 200},
+		{"POST not resent after 5xx", "POST", policy, 0, []reply{{status: 504}, {status: 200}}, 1, 504},
+		{"POST not resent after network error", "POST", policy, 0, []reply{{netErr: true}, {status: 200}}, 1, 0},
+		{"POST resent when throttled", "POST", policy, 0, []reply{{status: 429, retryAfter: "0"}, {status: 201}}, 2, 201},
+		{"503 with Retry-After", "POST", policy, 0, []reply{{status: 503, retryAfter: "0"}, {status: 200}}, 2, 200},
+		{"not found", "GET", policy, 0, []reply{{status: 404}, {status: 200}}, 1, 404},
+		{"MaxAttempts", "GET", policy, 0, []reply{{status: 504}, {status: 504}, {status: 504}, {status: 200}}, 3, 504},
+		{"MaxWait", "GET", RetryPolicy{MaxAttempts: 3, MaxWait: 500 * time.Millisecond},
+			0, []reply{{status: 429, retryAfter: "1"}, {status: 200}}, 1, 429},
+		{"deadline before Retry-After", "GET", policy, time.Second,
+			[]reply{{status: 429, retryAfter: "30"}, {status: 200}}, 1, 429},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				rp := tt.replies[calls-1]
+				if len(rp.retryAfter) > 0 {
+					w.Header().Set("Retry-After", rp.retryAfter)
+				}
+				w.WriteHeader(rp.status)
+			})
+			c.SetRetryPolicy(tt.policy)
+			c.SetTransport(RoundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				if r.URL.Path == "/v1.0/me" {
+					calls++
+					if tt.replies[calls-1].netErr {
+						return nil, errors.New("connection reset by peer")
+					}
+				}
+				return http.DefaultTransport.RoundTrip(r)
+			}))
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			res, err := c.send(ctx, tt.method, c.graphUrl("/me"), nil, []byte("{}"))
+			if res != nil {
+				res.Body.Close()
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("%d attempts, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantStatus == 0 && err == nil || tt.wantStatus > 0 && (err != nil || res.StatusCode != tt.wantStatus) {
+				t.Errorf("send() = %v, %v, want status %d", res, err, tt.wantStatus)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("send() took %v, want no wait beyond the limits", elapsed)
+			}
+		})
+	}
+}
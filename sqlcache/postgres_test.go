@@ -0,0 +1,38 @@
+//go:build postgres
+
+package sqlcache
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// With go test -tags postgres and the DSN of a scratch database in MSGRAPH_TEST_POSTGRES, e.g.
+// "postgres://user:pw@localhost/test?sslmode=disable", the cache tests run against PostgreSQL
+// with a table per test.
+func init() {
+	dsn := os.Getenv("MSGRAPH_TEST_POSTGRES")
+	if len(dsn) == 0 {
+		return
+	}
+	openTestDB = func(t *testing.T) (*sql.DB, Dialect, string) {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		table := "msgraph_tokens_" + strings.ToLower(t.Name())
+		if _, err = db.Exec(`DROP TABLE IF EXISTS ` + table); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			db.ExecContext(context.Background(), `DROP TABLE IF EXISTS `+table)
+			db.Close()
+		})
+		return db, Postgres, table
+	}
+}
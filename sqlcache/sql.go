@@ -0,0 +1,248 @@
+// Package sqlcache stores msgraph tokens in a SQL database so that replicas of a service share them.
+// SQLite and PostgreSQL are supported, through any database/sql driver; the tests run against PostgreSQL
+// with -tags postgres and a database in MSGRAPH_TEST_POSTGRES.
+//
+// Each token is a row keyed by msgraph.CacheKey, which expires when it hasn't been saved for Options.TTL;
+// Purge deletes expired rows.  A client that doesn't know its account yet, as when NewClient or
+// NewDeviceCodeClient start, loads the only token kept for its tenant and application.
+//
+// Refreshes are serialised across replicas with a lease taken by a conditional update of the row, so that
+// only one of them redeems a refresh token and the others load what it saved.  Optimistic locking, saving
+// only if the row is unchanged, would detect the conflict only after both replicas had redeemed the refresh
+// token, and the loser's rotated refresh token would be lost.  The lease expires after Options.LockTTL so
+// that a replica dying while it refreshes doesn't block the others.
+package sqlcache
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+
+	"github.com/jjcinaz/msgraph"
+	"github.com/jjcinaz/msgraph/cachecrypt"
+)
+
+type Dialect int
+
+const (
+	SQLite Dialect = iota
+	Postgres
+)
+
+type Options struct {
+	Dialect    Dialect
+	Table      string                // default "msgraph_tokens"
+	TTL        time.Duration         // evict tokens not saved for this long, default 90 days
+	LockTTL    time.Duration         // lease of the refresh lock, in case a replica dies holding it, default 30s
+	Encryption cachecrypt.KeyWrapper // encrypts token blobs when set
+}
+
+type Cache struct {
+	db   *sql.DB
+	opts Options
+}
+
+const lockPoll = 50 * time.Millisecond
+
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Creates a cache using the table named in opts, see CreateTable
+func New(db *sql.DB, opts Options) (*Cache, error) {
+	if len(opts.Table) == 0 {
+		opts.Table = "msgraph_tokens"
+	}
+	if !tableName.MatchString(opts.Table) {
+		return nil, fmt.Errorf("invalid table name %q", opts.Table)
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 90 * 24 * time.Hour
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = 30 * time.Second
+	}
+	return &Cache{db: db, opts: opts}, nil
+}
+
+// Creates the table if it doesn't exist
+func (sc *Cache) CreateTable(ctx context.Context) error {
+	blob := "BLOB"
+	if sc.opts.Dialect == Postgres {
+		blob = "BYTEA"
+	}
+	_, err := sc.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+sc.opts.Table+` (
+	cache_key  VARCHAR(512) PRIMARY KEY,
+	token      `+blob+`,
+	expires_at BIGINT NOT NULL,
+	lock_owner VARCHAR(64),
+	lock_until BIGINT
+)`)
+	return err
+}
+
+func (sc *Cache) Load(c *msgraph.Client) (*oauth2.Token, error) {
+	ctx := c.Context()
+	key := c.CacheKey()
+	name := key.String()
+	var blob []byte
+	err := sc.db.QueryRowContext(ctx, sc.query(`SELECT token FROM `+sc.opts.Table+
+		` WHERE cache_key = ? AND expires_at > ? AND token IS NOT NULL`),
+		name, time.Now().Unix()).Scan(&blob)
+	if errors.Is(err, sql.ErrNoRows) && len(key.Account) == 0 {
+		name, blob, err = sc.loadOnly(ctx, name)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, os.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	if blob, err = cachecrypt.Open(ctx, sc.opts.Encryption, name, blob); err != nil {
+		return nil, err
+	}
+	return msgraph.UnmarshalToken(blob)
+}
+
+func (sc *Cache) Save(c *msgraph.Client, token *oauth2.Token) error {
+	ctx := c.Context()
+	blob, err := msgraph.MarshalToken(token)
+	if err != nil {
+		return err
+	}
+	if blob, err = cachecrypt.Seal(ctx, sc.opts.Encryption, c.CacheKey().String(), blob); err != nil {
+		return err
+	}
+	_, err = sc.db.ExecContext(ctx, sc.query(`INSERT INTO `+sc.opts.Table+` (cache_key, token, expires_at) VALUES (?, ?, ?)
+ON CONFLICT (cache_key) DO UPDATE SET token = excluded.token, expires_at = excluded.expires_at`),
+		c.CacheKey().String(), blob, time.Now().Add(sc.opts.TTL).Unix())
+	return err
+}
+
+// loadOnly returns the only token whose key starts with prefix, or sql.ErrNoRows
+func (sc *Cache) loadOnly(ctx context.Context, prefix string) (string, []byte, error) {
+	rows, err := sc.db.QueryContext(ctx, sc.query(`SELECT cache_key, token FROM `+sc.opts.Table+
+		` WHERE cache_key LIKE ? ESCAPE '\' AND expires_at > ? AND token IS NOT NULL`),
+		likeEscaper.Replace(prefix)+"%", time.Now().Unix())
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+	var (
+		name  string
+		blob  []byte
+		found int
+	)
+	for rows.Next() {
+		var key string
+		var token []byte
+		if err = rows.Scan(&key, &token); err != nil {
+			return "", nil, err
+		}
+		if strings.HasPrefix(key, prefix) { // LIKE ignores case in SQLite
+			name, blob = key, token
+			found++
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return "", nil, err
+	}
+	if found != 1 {
+		return "", nil, sql.ErrNoRows
+	}
+	return name, blob, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Lock implements msgraph.TokenLocker, waiting until no other replica is refreshing the client's token
+func (sc *Cache) Lock(ctx context.Context, c *msgraph.Client) (func(), error) {
+	key := c.CacheKey().String()
+	owner := make([]byte, 16)
+	if _, err := rand.Read(owner); err != nil {
+		return nil, err
+	}
+	id := hex.EncodeToString(owner)
+	for {
+		ok, err := sc.tryLock(ctx, key, id)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+	return func() {
+		_, _ = sc.db.ExecContext(context.Background(), sc.query(`UPDATE `+sc.opts.Table+
+			` SET lock_owner = NULL, lock_until = NULL WHERE cache_key = ? AND lock_owner = ?`), key, id)
+	}, nil
+}
+
+// tryLock takes the lease if it is free or expired, or creates a placeholder row holding it
+func (sc *Cache) tryLock(ctx context.Context, key string, id string) (bool, error) {
+	now := time.Now()
+	until := now.Add(sc.opts.LockTTL).Unix()
+	res, err := sc.db.ExecContext(ctx, sc.query(`UPDATE `+sc.opts.Table+` SET lock_owner = ?, lock_until = ?
+WHERE cache_key = ? AND (lock_until IS NULL OR lock_until < ?)`), id, until, key, now.Unix())
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 1 {
+		return n == 1, err
+	}
+	res, err = sc.db.ExecContext(ctx, sc.query(`INSERT INTO `+sc.opts.Table+
+		` (cache_key, token, expires_at, lock_owner, lock_until) VALUES (?, NULL, 0, ?, ?) ON CONFLICT (cache_key) DO NOTHING`),
+		key, id, until)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// Removes the token stored for key, e.g. to sign a user out
+func (sc *Cache) Remove(ctx context.Context, key msgraph.CacheKey) error {
+	_, err := sc.db.ExecContext(ctx, sc.query(`DELETE FROM `+sc.opts.Table+` WHERE cache_key = ?`), key.String())
+	return err
+}
+
+// Deletes expired tokens, returning how many were removed.  Call it periodically.
+func (sc *Cache) Purge(ctx context.Context) (int64, error) {
+	now := time.Now().Unix()
+	res, err := sc.db.ExecContext(ctx, sc.query(`DELETE FROM `+sc.opts.Table+
+		` WHERE expires_at <= ? AND (lock_until IS NULL OR lock_until < ?)`), now, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// query rewrites ? placeholders for the dialect
+func (sc *Cache) query(q string) string {
+	if sc.opts.Dialect != Postgres {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
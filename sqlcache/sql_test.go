@@ -0,0 +1,179 @@
+package sqlcache
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"golang.org/x/oauth2"
+
+	"github.com/jjcinaz/msgraph"
+	"github.com/jjcinaz/msgraph/cachecrypt"
+)
+
+// openTestDB returns the database for a test, its dialect and a table of its own.  postgres_test.go
+// replaces it to run the tests against PostgreSQL.
+var openTestDB = func(t *testing.T) (*sql.DB, Dialect, string) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "tokens.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, SQLite, "msgraph_tokens"
+}
+
+func testCache(t *testing.T, opts Options) (*Cache, *sql.DB) {
+	db, dialect, table := openTestDB(t)
+	opts.Dialect, opts.Table = dialect, table
+	sc, err := New(db, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sc.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return sc, db
+}
+
+func testClient(t *testing.T) *msgraph.Client {
+	wa := msgraph.NewWebAuth("tenant", "client", "", "http://localhost/cb", nil, nil)
+	c, err := wa.ClientFromToken(context.Background(), &oauth2.Token{AccessToken: "at"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func accountClient(t *testing.T, oid string) *msgraph.Client {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"oid":"` + oid + `","tid":"tenant"}`))
+	token := (&oauth2.Token{AccessToken: "at-" + oid}).WithExtra(map[string]interface{}{"id_token": "e30." + claims + ".sig"})
+	wa := msgraph.NewWebAuth("tenant", "client", "", "http://localhost/cb", nil, nil)
+	c, err := wa.ClientFromToken(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCache(t *testing.T) {
+	kw, _ := cachecrypt.NewAESKeyWrapper(bytes.Repeat([]byte{7}, 32))
+	sc, db := testCache(t, Options{Encryption: kw})
+	c := testClient(t)
+
+	if _, err := sc.Load(c); !os.IsNotExist(err) {
+		t.Errorf("Load() from an empty cache error = %v", err)
+	}
+	for _, rt := range []string{"rt1", "rt2"} {
+		if err := sc.Save(c, &oauth2.Token{AccessToken: "at", RefreshToken: rt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var blob []byte
+	if err := db.QueryRow(`SELECT token FROM ` + sc.opts.Table).Scan(&blob); err != nil || bytes.Contains(blob, []byte("rt2")) {
+		t.Errorf("token stored unencrypted or missing: %v", err)
+	}
+	token, err := sc.Load(c)
+	if err != nil || token.RefreshToken != "rt2" {
+		t.Fatalf("Load() = %v, %v", token, err)
+	}
+	if err = sc.Remove(context.Background(), c.CacheKey()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sc.Load(c); !os.IsNotExist(err) {
+		t.Errorf("Load() after Remove() error = %v", err)
+	}
+}
+
+func TestCache_ttl(t *testing.T) {
+	sc, _ := testCache(t, Options{TTL: time.Nanosecond})
+	c := testClient(t)
+	if err := sc.Save(c, &oauth2.Token{AccessToken: "at"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond) // expiry has a resolution of a second
+	if _, err := sc.Load(c); !os.IsNotExist(err) {
+		t.Errorf("Load() of an expired token error = %v", err)
+	}
+	if n, err := sc.Purge(context.Background()); err != nil || n != 1 {
+		t.Errorf("Purge() = %d, %v, want 1", n, err)
+	}
+}
+
+func TestCache_Lock(t *testing.T) {
+	sc, db := testCache(t, Options{})
+	replica2, _ := New(db, Options{Dialect: sc.opts.Dialect, Table: sc.opts.Table})
+	c := testClient(t)
+
+	unlock, err := sc.Lock(context.Background(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the holder saves the refreshed token while still holding the lease
+	if err = sc.Save(c, &oauth2.Token{AccessToken: "at2"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err = replica2.Lock(ctx, c); err == nil {
+		t.Fatal("Lock() succeeded while another replica held it")
+	}
+	unlock()
+	unlock2, err := replica2.Lock(context.Background(), c)
+	if err != nil {
+		t.Fatalf("Lock() after unlock error = %v", err)
+	}
+	unlock2()
+	if token, err := sc.Load(c); err != nil || token.AccessToken != "at2" {
+		t.Errorf("Load() = %v, %v", token, err)
+	}
+}
+
+func TestCache_onlyAccount(t *testing.T) {
+	kw, _ := cachecrypt.NewAESKeyWrapper(bytes.Repeat([]byte{7}, 32))
+	sc, db := testCache(t, Options{Encryption: kw})
+	alice, bob, starting := accountClient(t, "alice"), accountClient(t, "bob"), testClient(t)
+	if err := sc.Save(alice, &oauth2.Token{AccessToken: "at-alice"}); err != nil {
+		t.Fatal(err)
+	}
+	// a client that doesn't know its account yet gets the only one cached
+	if token, err := sc.Load(starting); err != nil || token.AccessToken != "at-alice" {
+		t.Errorf("Load() = %v, %v, want alice's token", token, err)
+	}
+	if err := sc.Save(bob, &oauth2.Token{AccessToken: "at-bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.Load(starting); !os.IsNotExist(err) {
+		t.Errorf("Load() with two accounts cached error = %v", err)
+	}
+
+	// a token copied to another account's row cannot be decrypted
+	_, err := db.Exec(sc.query(`UPDATE `+sc.opts.Table+` SET token = (SELECT token FROM `+sc.opts.Table+
+		` WHERE cache_key = ?) WHERE cache_key = ?`), alice.CacheKey().String(), bob.CacheKey().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, err := sc.Load(bob); err == nil {
+		t.Errorf("Load() of a swapped token = %v", token)
+	}
+}
+
+func TestCache_query(t *testing.T) {
+	q := `SELECT token FROM t WHERE cache_key LIKE ? ESCAPE '\' AND expires_at > ?`
+	sqlite, _ := New(nil, Options{})
+	if got := sqlite.query(q); got != q {
+		t.Errorf("SQLite query = %s", got)
+	}
+	postgres, _ := New(nil, Options{Dialect: Postgres})
+	if got := postgres.query(q); got != `SELECT token FROM t WHERE cache_key LIKE $1 ESCAPE '\' AND expires_at > $2` {
+		t.Errorf("PostgreSQL query = %s", got)
+	}
+	if got := likeEscaper.Replace(`t_1/c%2\/`); got != `t\_1/c\%2\\/` {
+		t.Errorf("escaped LIKE pattern %s", got)
+	}
+}
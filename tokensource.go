@@ -0,0 +1,161 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// credential holds the current access token of a client, requesting a new one only when it is
+// about to expire.  Concurrent callers wait for a single fetch.
+type credential struct {
+	mu    sync.Mutex
+	token *oauth2.Token
+	fetch func(ctx context.Context) (*oauth2.Token, error)
+}
+
+func newCredential(fetch func(ctx context.Context) (*oauth2.Token, error)) *credential {
+	return &credential{fetch: fetch}
+}
+
+func (cr *credential) Token(ctx context.Context) (*oauth2.Token, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if !cr.token.Valid() {
+		token, err := cr.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cr.token = token
+	}
+	// a copy, as oauth2.ReuseTokenSource modifies the tokens it is given
+	token := *cr.token
+	return &token, nil
+}
+
+// tokenSource binds a credential to the context of a call for oauth2.NewClient
+type tokenSource struct {
+	ctx context.Context
+	cr  *credential
+}
+
+func (ts tokenSource) Token() (*oauth2.Token, error) {
+	return ts.cr.Token(ts.ctx)
+}
+
+// CacheKey identifies the tokens of a client for a TokenCache: the tenant, the application and,
+// for delegated access, the signed in account
+type CacheKey struct {
+	TenantID string
+	ClientID string
+	Account  string // Account.Key, empty when not known
+}
+
+func (k CacheKey) String() string {
+	return k.TenantID + "/" + k.ClientID + "/" + k.Account
+}
+
+// TokenLocker may be implemented by a TokenCache shared between processes.  Lock is held while a
+// refresh token is redeemed and the result saved, so that only one process redeems it.
+type TokenLocker interface {
+	Lock(ctx context.Context, c *Client) (unlock func(), err error)
+}
+
+// storedToken is the JSON form of a cached token.  Unlike that of oauth2.Token it keeps the id_token,
+// which names the account of a client created from the cache.
+type storedToken struct {
+	*oauth2.Token
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// Encodes a token for a TokenCache, keeping the id_token so that a client loading it again knows its account
+func MarshalToken(token *oauth2.Token) ([]byte, error) {
+	idToken, _ := token.Extra("id_token").(string)
+	return json.Marshal(storedToken{Token: token, IDToken: idToken})
+}
+
+// Decodes a token encoded by MarshalToken or as a plain oauth2.Token
+func UnmarshalToken(data []byte) (*oauth2.Token, error) {
+	st := storedToken{Token: new(oauth2.Token)}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, err
+	}
+	return withIDToken(st.Token, st.IDToken), nil
+}
+
+// withIDToken attaches idToken to a token without one, e.g. a refreshed token
+func withIDToken(token *oauth2.Token, idToken string) *oauth2.Token {
+	if current, _ := token.Extra("id_token").(string); len(current) > 0 || len(idToken) == 0 {
+		return token
+	}
+	return token.WithExtra(map[string]interface{}{"id_token": idToken})
+}
+
+// Returns the key under which a TokenCache should store the client's token
+func (c *Client) CacheKey() CacheKey {
+	clientID := c.OauthConfig.ClientID
+	if len(clientID) == 0 {
+		clientID = c.ccConfig.ClientID
+	}
+	return CacheKey{TenantID: c.tenantID, ClientID: clientID, Account: c.account.Key()}
+}
+
+// Returns a token source for the client's access token, e.g. for use with other SDKs.  Delegated tokens
+// refreshed through it are saved to the client's TokenCache, as for API calls.
+func (c *Client) TokenSource(ctx context.Context) oauth2.TokenSource {
+	ctx = c.oauthContext(ctx)
+	if c.credential != nil {
+		return tokenSource{ctx: ctx, cr: c.credential}
+	}
+	if c.authType == AuthTypeClientKey {
+		return c.ccConfig.TokenSource(ctx)
+	}
+	return c.OauthConfig.TokenSource(ctx, c.token)
+}
+
+// refreshLocks serialises refreshes of the same token by clients within the process, keyed by CacheKey
+var refreshLocks sync.Map
+
+// persist makes the client refresh its delegated token through cache, saving every new token to it
+func (c *Client) persist(cache TokenCache) {
+	cr := &credential{token: c.token}
+	cr.fetch = func(ctx context.Context) (*oauth2.Token, error) {
+		return c.refreshToken(ctx, cache, cr.token) // called with cr locked
+	}
+	c.credential = cr
+}
+
+func (c *Client) refreshToken(ctx context.Context, cache TokenCache, current *oauth2.Token) (*oauth2.Token, error) {
+	lock, _ := refreshLocks.LoadOrStore(c.CacheKey().String(), new(sync.Mutex))
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	if locker, ok := cache.(TokenLocker); ok {
+		unlock, err := locker.Lock(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	// another client or process may have refreshed it already
+	if cached, err := cache.Load(c); err == nil && cached.Valid() && (current == nil || cached.AccessToken != current.AccessToken) {
+		return cached, nil
+	}
+	if current == nil || len(current.RefreshToken) == 0 {
+		return nil, errors.New("token expired and cannot be refreshed, sign in again")
+	}
+	token, err := c.OauthConfig.TokenSource(c.oauthContext(ctx), &oauth2.Token{RefreshToken: current.RefreshToken}).Token()
+	if err != nil {
+		return nil, err
+	}
+	idToken, _ := current.Extra("id_token").(string)
+	token = withIDToken(token, idToken) // refresh responses may leave it out
+	if err = cache.Save(c, token); err != nil {
+		// not kept either, so the next call redeems the old refresh token again
+		return nil, fmt.Errorf("saving refreshed token: %w", err)
+	}
+	return token, nil
+}
@@ -0,0 +1,143 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestClient_persist(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		refreshes int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/token") {
+			mu.Lock()
+			refreshes++
+			mu.Unlock()
+			if r.FormValue("grant_type") != "refresh_token" || r.FormValue("refresh_token") != "rt1" {
+				t.Errorf("unexpected token request %v", r.Form)
+			}
+			time.Sleep(10 * time.Millisecond) // let concurrent calls pile up
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at2", "refresh_token": "rt2",
+				"token_type": "Bearer", "expires_in": 3600})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer at2" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+
+	cache := accountCache{}
+	wa := NewWebAuth("tenant", "client", "", "http://localhost/cb", nil, cache,
+		WithAuthorityHost(srv.URL), WithGraphEndpoint(srv.URL))
+	expired := &oauth2.Token{AccessToken: "at1", RefreshToken: "rt1", Expiry: time.Now().Add(-time.Minute)}
+	c, err := wa.ClientFromToken(context.Background(), expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Do(Request{Path: "/me"}, nil); err != nil {
+				t.Errorf("Do() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if refreshes != 1 {
+		t.Errorf("%d refreshes, want 1", refreshes)
+	}
+	if saved := cache[""]; saved == nil || saved.RefreshToken != "rt2" {
+		t.Errorf("rotated refresh token was not saved, got %+v", saved)
+	}
+
+	// a second client for the same user picks up the saved token rather than refreshing again
+	c2, _ := wa.ClientFromToken(context.Background(), expired)
+	if err = c2.Do(Request{Path: "/me"}, nil); err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	if refreshes != 1 {
+		t.Errorf("%d refreshes, want 1", refreshes)
+	}
+}
+
+// blobCache holds one token encoded as a distributed cache would, whatever the client's key
+type blobCache struct {
+	blob []byte
+	keys []CacheKey
+}
+
+func (bc *blobCache) Load(c *Client) (*oauth2.Token, error) {
+	bc.keys = append(bc.keys, c.CacheKey())
+	return UnmarshalToken(bc.blob)
+}
+
+func (bc *blobCache) Save(c *Client, token *oauth2.Token) (err error) {
+	bc.keys = append(bc.keys, c.CacheKey())
+	bc.blob, err = MarshalToken(token)
+	return err
+}
+
+func TestClient_cachedAccount(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/token") {
+			io.WriteString(w, `{"access_token":"at2","refresh_token":"rt2","token_type":"Bearer","expires_in":3600}`)
+			return
+		}
+		io.WriteString(w, `{}`)
+	}))
+	defer srv.Close()
+
+	idToken := testIDToken(map[string]string{"oid": "u1", "tid": "tenant"})
+	signedIn := (&oauth2.Token{AccessToken: "at1", RefreshToken: "rt1", Expiry: time.Now().Add(-time.Minute)}).
+		WithExtra(map[string]interface{}{"id_token": idToken})
+	cache := &blobCache{}
+	var err error
+	if cache.blob, err = MarshalToken(signedIn); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restarted client learns its account from the cached token
+	c, err := NewDeviceCodeClient(context.Background(), "tenant", "client", nil, cache, nil,
+		WithAuthorityHost(srv.URL), WithGraphEndpoint(srv.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Account().ID != "u1" {
+		t.Errorf("Account() = %+v, want the cached id_token's", c.Account())
+	}
+	if err = c.Do(Request{Path: "/me"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := CacheKey{TenantID: "tenant", ClientID: "client", Account: c.Account().Key()}
+	if n := len(cache.keys); n < 2 || cache.keys[n-1] != want {
+		t.Errorf("refresh used cache keys %v, want %v", cache.keys, want)
+	}
+	// the refresh response had no id_token, the saved token keeps the one from sign in
+	refreshed, _ := UnmarshalToken(cache.blob)
+	if a, err := accountFromToken(refreshed); err != nil || refreshed.AccessToken != "at2" || a.ID != "u1" {
+		t.Errorf("saved %+v with account %+v, err %v", refreshed, a, err)
+	}
+
+	// tokens stored as plain JSON still load
+	plain, _ := json.Marshal(signedIn)
+	if token, err := UnmarshalToken(plain); err != nil || token.RefreshToken != "rt1" || token.Extra("id_token") != nil {
+		t.Errorf("UnmarshalToken() = %+v, %v", token, err)
+	}
+}
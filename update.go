@@ -0,0 +1,27 @@
+package msgraph
+
+// The update types (MessageUpdate, EventUpdate, UserUpdate) describe partial updates sent with
+// PATCH.  Only fields which are not nil are sent, so a field can be set to its zero value
+// (false, "" or an empty list) without the other properties of the item being overwritten:
+//
+//	upd := msgraph.MessageUpdate{IsRead: msgraph.Bool(true)}
+//	msg, err := c.UpdateMessage("bob@acme.com", msgId, upd)
+
+func Bool(v bool) *bool {
+	return &v
+}
+
+func String(v string) *string {
+	return &v
+}
+
+func Int(v int) *int {
+	return &v
+}
+
+func Strings(v ...string) *[]string {
+	if v == nil {
+		v = []string{}
+	}
+	return &v
+}
@@ -0,0 +1,81 @@
+package msgraph
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestUpdates(t *testing.T) {
+	type received struct {
+		method, path, query, body string
+	}
+	var got []received
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got = append(got, received{r.Method, r.URL.Path, r.URL.RawQuery, string(body)})
+		if r.URL.Path == "/v1.0/users/bob" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte(`{"id":"1"}`))
+	})
+
+	if _, err := c.UpdateMessage("bob", "m1", MessageUpdate{IsRead: Bool(false), Subject: String("")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MarkMessageRead("bob", "m1", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.UpdateEvent("bob", "e1", EventUpdate{IsReminderOn: Bool(false), Categories: &[]string{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateUser("bob", UserUpdate{AccountEnabled: Bool(false), JobTitle: String("")}); err != nil {
+		t.Fatal(err)
+	}
+	want := []received{
+		{"PATCH", "/v1.0/users/bob/messages/m1", "", `{"isRead":false,"subject":""}`},
+		{"PATCH", "/v1.0/users/bob/messages/m1", "", `{"isRead":true}`},
+		{"PATCH", "/v1.0/users/bob/events/e1", "", `{"categories":[],"isReminderOn":false}`},
+		{"PATCH", "/v1.0/users/bob", "", `{"accountEnabled":false,"jobTitle":""}`},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d requests, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("request %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	var ifMatch []string
+	c, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		ifMatch = append(ifMatch, r.Header.Get("If-Match"))
+		if r.Method == "DELETE" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusPreconditionFailed)
+		w.Write([]byte(`{"error":{"code":"ErrorIrresolvableConflict","message":"The send or update operation could not be performed because the change key passed in the request does not match the current change key for the item."}}`))
+	})
+
+	m := Message{ETag: `W/"CQAAABYAAAB"`, ChangeKey: "ignored"}
+	_, err := c.UpdateMessage("bob", "m1", MessageUpdate{IsRead: Bool(true)}, m.IfMatch())
+	if !IsConflict(err) {
+		t.Errorf("UpdateMessage() error = %v, want a conflict", err)
+	}
+	if err = c.DeleteEvent("bob", "e1", Event{ChangeKey: "DwAAABYAAAB"}.IfMatch()); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.DeleteMessage("bob", "m1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(ifMatch) != 3 || ifMatch[0] != `W/"CQAAABYAAAB"` || ifMatch[1] != `W/"DwAAABYAAAB"` || ifMatch[2] != "" {
+		t.Errorf("If-Match headers %q", ifMatch)
+	}
+	if IsConflict(&MsGraphError{HttpStatusCode: http.StatusConflict, Code: "ErrorFolderExists"}) {
+		t.Error("HTTP 409 reported as a conflicting change")
+	}
+}
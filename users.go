@@ -1,14 +1,12 @@
 package msgraph
 
 import (
-	"encoding/json"
 	"image"
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
 	"net/url"
-	"strings"
 )
 
 type User struct {
@@ -51,6 +49,31 @@ type User struct {
 	UserPrincipalName           string   `json:"userPrincipalName"`
 }
 
+// UserUpdate holds the properties to change with UpdateUser; nil fields are left unchanged
+type UserUpdate struct {
+	AccountEnabled    *bool     `json:"accountEnabled,omitempty"`
+	BusinessPhones    *[]string `json:"businessPhones,omitempty"`
+	City              *string   `json:"city,omitempty"`
+	CompanyName       *string   `json:"companyName,omitempty"`
+	Country           *string   `json:"country,omitempty"`
+	Department        *string   `json:"department,omitempty"`
+	DisplayName       *string   `json:"displayName,omitempty"`
+	EmployeeID        *string   `json:"employeeId,omitempty"`
+	FaxNumber         *string   `json:"faxNumber,omitempty"`
+	GivenName         *string   `json:"givenName,omitempty"`
+	JobTitle          *string   `json:"jobTitle,omitempty"`
+	MailNickname      *string   `json:"mailNickname,omitempty"`
+	MobilePhone       *string   `json:"mobilePhone,omitempty"`
+	OfficeLocation    *string   `json:"officeLocation,omitempty"`
+	PostalCode        *string   `json:"postalCode,omitempty"`
+	PreferredLanguage *string   `json:"preferredLanguage,omitempty"`
+	ShowInAddressList *bool     `json:"showInAddressList,omitempty"`
+	State             *string   `json:"state,omitempty"`
+	StreetAddress     *string   `json:"streetAddress,omitempty"`
+	Surname           *string   `json:"surname,omitempty"`
+	UsageLocation     *string   `json:"usageLocation,omitempty"`
+}
+
 type PhotoInfo struct {
 	ContentType string `json:"@odata.mediaContentType"`
 	Height      int    `json:"height"`
@@ -58,75 +81,86 @@ type PhotoInfo struct {
 	Width       int    `json:"width"`
 }
 
-func (c *Client) GetUserList() ([]User, error) {
-	var (
-		parms = []string{
-			//"aboutMe",
-			"accountEnabled",
-			//"birthday",
-			"businessPhones",
-			//"city",
-			"companyName",
-			//"country",
-			"department",
-			"displayName",
-			"employeeId",
-			"faxNumber",
-			"givenName",
-			//"hireDate",
-			"id",
-			"isResourceAccount",
-			"jobTitle",
-			"lastPasswordChangeDateTime",
-			"mail",
-			"mailNickname",
-			"mobilePhone",
-			"officeLocation",
-			//"onPremisesDistinguishedName",
-			"onPremisesDomainName",
-			//"onPremisesImmutableId",
-			"onPremisesLastSyncDateTime",
-			"onPremisesSamAccountName",
-			"onPremisesSyncEnabled",
-			"onPremisesUserPrincipalName",
-			//"postalCode",
-			//"preferredDataLocation",
-			//"preferredLanguage",
-			"proxyAddresses",
-			"showInAddressList",
-			"state",
-			"streetAddress",
-			"surname",
-			"userPrincipalName",
-		}
-		err error
-	)
+var userListFields = []string{
+	//"aboutMe",
+	"accountEnabled",
+	//"birthday",
+	"businessPhones",
+	//"city",
+	"companyName",
+	//"country",
+	"department",
+	"displayName",
+	"employeeId",
+	"faxNumber",
+	"givenName",
+	//"hireDate",
+	"id",
+	"isResourceAccount",
+	"jobTitle",
+	"lastPasswordChangeDateTime",
+	"mail",
+	"mailNickname",
+	"mobilePhone",
+	"officeLocation",
+	//"onPremisesDistinguishedName",
+	"onPremisesDomainName",
+	//"onPremisesImmutableId",
+	"onPremisesLastSyncDateTime",
+	"onPremisesSamAccountName",
+	"onPremisesSyncEnabled",
+	"onPremisesUserPrincipalName",
+	//"postalCode",
+	//"preferredDataLocation",
+	//"preferredLanguage",
+	"proxyAddresses",
+	"showInAddressList",
+	"state",
+	"streetAddress",
+	"surname",
+	"userPrincipalName",
+}
 
-	apiUrl := "https://graph.microsoft.com/v1.0/users?$select=" + strings.Join(parms, ",")
+// Lists the users which are synchronised from an on-premises directory
+func (c *Client) GetUserList() ([]User, error) {
 	// MS Graph API says it supports a filter option but that filter option doesn't actually
 	// work for onPremisesSamAccountName (it doens't actually work for most of the fields);
 	// but that's expected Microsoft quality.  I'm sure they will replace the entire API
 	// with "something better" in a year anyway.  For now we have to manually filter.
+	p, err := c.GetUserListPager()
+	if err != nil {
+		return nil, err
+	}
 	users := make([]User, 0, 128)
-	c.executeGetList(apiUrl, nil, func(body io.Reader) string {
-		var (
-			reply struct {
-				Context  string `json:"@odata.context"`
-				Nextlink string `json:"@odata.nextLink"`
-				Data     []User `json:"value"`
-			}
-		)
-		if err = json.NewDecoder(body).Decode(&reply); err == nil {
-			for _, u := range reply.Data {
-				if len(u.OnPremisesSamAccountName) > 0 {
-					users = append(users, u)
-				}
-			}
-			return reply.Nextlink
+	for p.Next() {
+		if u := p.Item(); len(u.OnPremisesSamAccountName) > 0 {
+			users = append(users, u)
 		}
-		return ""
-	})
-	return users, err
+	}
+	return users, p.Err()
+}
+
+// Pages through all users.  Unless the options include OptionSelect, the fields listed
+// in userListFields are selected.
+func (c *Client) GetUserListPager(options ...ApiOption) (*Pager[User], error) {
+	hasSelect := false
+	for _, o := range options {
+		if _, ok := o.(optSelect); ok {
+			hasSelect = true
+		}
+	}
+	if !hasSelect {
+		// copy so that the caller's slice isn't appended to
+		options = append(make([]ApiOption, 0, len(options)+len(userListFields)), options...)
+		for _, f := range userListFields {
+			options = append(options, OptionSelect(f))
+		}
+	}
+	apiUrl, err := formatOptions(c.graphUrl("/users"), options...)
+	if err != nil {
+		return nil, err
+	}
+	return newPager[User](c, apiUrl, options), nil
 }
 
 // Get profile picture given a UserPrincipalName (e.g. "bob@acme.com") or User Id (UUID)
@@ -137,7 +171,7 @@ func (c *Client) GetUserPhoto(upn string) (image.Image, string, error) {
 		img  image.Image
 		info string
 	)
-	apiUrl := "https://graph.microsoft.com/v1.0/users/" + url.PathEscape(upn) + "/photo/$value"
+	apiUrl := c.graphUrl("/users/" + url.PathEscape(upn) + "/photo/$value")
 	err = c.executeGet(apiUrl, func(reader io.Reader) error {
 		var err2 error
 		img, info, err2 = image.Decode(reader)
@@ -152,7 +186,18 @@ func (c *Client) GetUserPhoto(upn string) (image.Image, string, error) {
 // Get profile picture info given a UserPrincipalName (e.g. "bob@acme.com") or User Id (UUID)
 func (c *Client) GetUserPhotoInfo(upn string) (PhotoInfo, error) {
 	var pi PhotoInfo
-	apiUrl := "https://graph.microsoft.com/v1.0/users/" + url.PathEscape(upn) + "/photo"
+	apiUrl := c.graphUrl("/users/" + url.PathEscape(upn) + "/photo")
 	err := c.executeGetJson(apiUrl, &pi)
 	return pi, err
 }
+
+// Update properties of a user given a UserPrincipalName (e.g. "bob@acme.com") or User Id (UUID).
+// Only the non-nil fields of update are changed.
+func (c *Client) UpdateUser(upn string, update UserUpdate) error {
+	return c.executePatch(c.graphUrl("/users/"+url.PathEscape(upn)), nil, update, nil)
+}
+
+// Replace the profile picture of a user.  contentType is the image type, e.g. "image/jpeg".
+func (c *Client) SetUserPhoto(upn string, contentType string, photo []byte) error {
+	return c.executePut(c.graphUrl("/users/"+url.PathEscape(upn)+"/photo/$value"), contentType, photo, nil)
+}
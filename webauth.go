@@ -0,0 +1,181 @@
+package msgraph
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// WebAuth runs the Authorization Code Grant flow with PKCE [see https://oauth.net/2/pkce/] for a web application
+// which owns its own HTTP server.  A sign in is split in two:
+//
+//	// handler starting a sign in
+//	authUrl, state, err := wa.AuthCodeURL()
+//	// keep state in the user's session, then redirect the browser to authUrl
+//
+//	// handler for the redirect URI
+//	c, err := wa.Complete(r.Context(), r, state)
+//	// remember c.Account() in the session
+//
+//	// later requests for the same user
+//	c, err := wa.ClientForUser(r.Context(), account)
+//
+// Tokens are stored in the TokenCache, which should key them on Client.CacheKey.
+type WebAuth struct {
+	config   oauth2.Config
+	tenantID string
+	cache    TokenCache
+	options  []ClientOption
+}
+
+// AuthState ties the redirect back to the sign in which started it.  It must be kept on the server side or
+// in an encrypted cookie, never sent to the browser in the clear, as the verifier proves possession of the code.
+type AuthState struct {
+	State    string
+	Verifier string
+}
+
+// Account identifies the user a delegated token was issued to, taken from the token's id_token
+type Account struct {
+	ID       string // the user's object ID
+	TenantID string
+	Username string // usually the UPN
+	Name     string
+}
+
+// Key returns a string identifying the account, suitable for keying per user token storage
+func (a Account) Key() string {
+	if len(a.ID) == 0 {
+		return ""
+	}
+	return a.ID + "." + a.TenantID
+}
+
+// Creates a WebAuth for a registered web application.  redirectURL must be one of the redirect URIs of the
+// App Registration and is where the browser returns with the code.  ClientSecret may be empty for public clients.
+func NewWebAuth(TenantID string, ClientID string, ClientSecret string, redirectURL string, scopes []string,
+	cache TokenCache, options ...ClientOption) *WebAuth {
+	if cache == nil {
+		cache = NullCache{}
+	}
+	w := &WebAuth{tenantID: TenantID, cache: cache, options: options}
+	c := w.newClient(context.Background())
+	w.config = oauth2.Config{
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		Endpoint:     c.authEndpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       append([]string{"openid", "profile", "offline_access"}, scopes...),
+	}
+	return w
+}
+
+// Returns the URL to send the user's browser to and the state to keep for Complete.  opts may add
+// parameters such as oauth2.SetAuthURLParam("login_hint", upn).
+func (w *WebAuth) AuthCodeURL(opts ...oauth2.AuthCodeOption) (string, AuthState, error) {
+	state, err := generateNonce(16)
+	if err != nil {
+		return "", AuthState{}, err
+	}
+	as := AuthState{State: state, Verifier: oauth2.GenerateVerifier()}
+	opts = append(opts, oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(as.Verifier))
+	return w.config.AuthCodeURL(as.State, opts...), as, nil
+}
+
+// Completes a sign in from the request to the redirect URI, exchanging its code for a token which is saved
+// to the cache.  Returns a Client acting as the signed in user.
+func (w *WebAuth) Complete(ctx context.Context, r *http.Request, state AuthState) (*Client, error) {
+	q := r.URL.Query()
+	if e := q.Get("error"); len(e) > 0 {
+		return nil, fmt.Errorf("sign in failed: %s: %s", e, q.Get("error_description"))
+	}
+	if len(state.State) == 0 || subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(state.State)) != 1 {
+		return nil, errors.New("sign in state does not match")
+	}
+	code := q.Get("code")
+	if len(code) == 0 {
+		return nil, errors.New("no authorization code in the redirect")
+	}
+	c := w.newClient(ctx)
+	token, err := c.OauthConfig.Exchange(c.oauthContext(ctx), code, oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		return nil, err
+	}
+	c.token = token
+	if c.account, err = accountFromToken(token); err != nil {
+		return nil, err
+	}
+	if err = w.cache.Save(c, token); err != nil {
+		return nil, err
+	}
+	c.persist(w.cache)
+	return c, nil
+}
+
+// Returns a Client for a user who signed in earlier, using the token saved in the cache
+func (w *WebAuth) ClientForUser(ctx context.Context, account Account) (*Client, error) {
+	c := w.newClient(ctx)
+	c.account = account
+	token, err := w.cache.Load(c)
+	if err != nil {
+		return nil, err
+	}
+	c.token = token
+	c.persist(w.cache)
+	return c, nil
+}
+
+// Returns a Client for the user of a token the application stored by other means.  Refreshed tokens
+// are saved to the WebAuth's cache.
+func (w *WebAuth) ClientFromToken(ctx context.Context, token *oauth2.Token) (*Client, error) {
+	c := w.newClient(ctx)
+	c.token = token
+	c.account, _ = accountFromToken(token) // unless it was refreshed outside the client
+	c.persist(w.cache)
+	return c, nil
+}
+
+func (w *WebAuth) newClient(ctx context.Context) *Client {
+	c := newClient(ctx, AuthTypeAuthCode, w.tenantID, w.options)
+	c.OauthConfig = w.config
+	return c
+}
+
+// Returns the account the client acts for, when it was signed in with a delegated flow
+func (c *Client) Account() Account {
+	return c.account
+}
+
+// accountFromToken reads the claims of a token's id_token.  The signature isn't checked, which OpenID Connect
+// permits for an id_token received directly from the token endpoint over TLS.
+func accountFromToken(token *oauth2.Token) (Account, error) {
+	idToken, _ := token.Extra("id_token").(string)
+	if len(idToken) == 0 {
+		return Account{}, errors.New("no id_token returned, the openid scope is required")
+	}
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return Account{}, errors.New("malformed id_token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Account{}, fmt.Errorf("malformed id_token: %w", err)
+	}
+	var claims struct {
+		ObjectID          string `json:"oid"`
+		TenantID          string `json:"tid"`
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return Account{}, fmt.Errorf("malformed id_token: %w", err)
+	}
+	return Account{ID: claims.ObjectID, TenantID: claims.TenantID, Username: claims.PreferredUsername, Name: claims.Name}, nil
+}
@@ -0,0 +1,90 @@
+package msgraph
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func testIDToken(claims map[string]string) string {
+	payload, _ := json.Marshal(claims)
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".sig"
+}
+
+type accountCache map[string]*oauth2.Token
+
+func (ac accountCache) Load(c *Client) (*oauth2.Token, error) {
+	if t, ok := ac[c.Account().Key()]; ok {
+		return t, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (ac accountCache) Save(c *Client, token *oauth2.Token) error {
+	ac[c.Account().Key()] = token
+	return nil
+}
+
+func TestWebAuth(t *testing.T) {
+	var verifier string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant/oauth2/v2.0/token" || r.FormValue("code") != "thecode" {
+			t.Errorf("unexpected request %s %v", r.URL.Path, r.Form)
+		}
+		verifier = r.FormValue("code_verifier")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "abc", "token_type": "Bearer", "expires_in": 3600,
+			"id_token": testIDToken(map[string]string{"oid": "u1", "tid": "t1", "preferred_username": "bob@acme.com"})})
+	}))
+	defer srv.Close()
+
+	cache := accountCache{}
+	wa := NewWebAuth("tenant", "client", "secret", "https://app.acme.com/callback", []string{"Mail.Read"}, cache,
+		WithAuthorityHost(srv.URL))
+	authUrl, state, err := wa.AuthCodeURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authUrl)
+	q := u.Query()
+	if q.Get("state") != state.State || q.Get("code_challenge_method") != "S256" || q.Get("redirect_uri") != "https://app.acme.com/callback" {
+		t.Errorf("unexpected auth URL %s", authUrl)
+	}
+
+	bad := httptest.NewRequest("GET", "/callback?code=thecode&state=forged", nil)
+	if _, err = wa.Complete(context.Background(), bad, state); err == nil {
+		t.Error("Complete() accepted a forged state")
+	}
+	denied := httptest.NewRequest("GET", "/callback?error=access_denied&state="+state.State, nil)
+	if _, err = wa.Complete(context.Background(), denied, state); err == nil {
+		t.Error("Complete() accepted an error redirect")
+	}
+
+	r := httptest.NewRequest("GET", "/callback?code=thecode&state="+url.QueryEscape(state.State), nil)
+	c, err := wa.Complete(context.Background(), r, state)
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if verifier != state.Verifier {
+		t.Errorf("code_verifier = %q, want %q", verifier, state.Verifier)
+	}
+	account := c.Account()
+	if account.ID != "u1" || account.Username != "bob@acme.com" {
+		t.Errorf("Account() = %+v", account)
+	}
+
+	c, err = wa.ClientForUser(context.Background(), account)
+	if err != nil || c.token.AccessToken != "abc" {
+		t.Fatalf("ClientForUser() = %v, %v", c, err)
+	}
+	if _, err = wa.ClientForUser(context.Background(), Account{ID: "other"}); err == nil {
+		t.Error("ClientForUser() found a token for an unknown user")
+	}
+}